@@ -55,7 +55,14 @@ func Preload[T any](ctx context.Context, targets []*T, fields ...string) error {
 		for i, target := range targets {
 			vals[i] = reflect.ValueOf(target).Elem()
 		}
-		if err := assoc.preload(ctx, t.fldcol, t.mainKey, vals); err != nil {
+		spanCtx, sp := startSpan(ctx, "psql.preload",
+			Attr{AttrTable, t.table},
+			Attr{AttrPreload, fieldName},
+			Attr{AttrRowCount, int64(len(targets))},
+		)
+		err := assoc.preload(spanCtx, t.fldcol, t.mainKey, vals)
+		endSpan(sp, err)
+		if err != nil {
 			return err
 		}
 	}
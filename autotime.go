@@ -0,0 +1,73 @@
+package psql
+
+import (
+	"reflect"
+	"time"
+)
+
+// autoTimeAttr returns whether the given auto timestamp attribute is set on a
+// field, and whether it was explicitly disabled (e.g. autoCreateTime=false).
+func autoTimeAttr(attrs map[string]string, name string) (enabled, disabled bool) {
+	v, ok := attrs[name]
+	if !ok {
+		return false, false
+	}
+	switch v {
+	case "0", "false":
+		return false, true
+	}
+	return true, false
+}
+
+// isTimeType returns true for time.Time and *time.Time.
+func isTimeType(typ reflect.Type) bool {
+	return typ == timeType || typ == ptrTimeType
+}
+
+// setTime assigns tm to a time.Time or *time.Time field.
+func setTime(f reflect.Value, tm time.Time) {
+	if f.Kind() == reflect.Ptr {
+		f.Set(reflect.ValueOf(&tm))
+		return
+	}
+	f.Set(reflect.ValueOf(tm))
+}
+
+// isZeroTime returns true if a time.Time or *time.Time field is unset.
+func isZeroTime(f reflect.Value) bool {
+	if f.Kind() == reflect.Ptr {
+		if f.IsNil() {
+			return true
+		}
+		f = f.Elem()
+	}
+	return f.Interface().(time.Time).IsZero()
+}
+
+// touchCreate fills the CreatedAt and UpdatedAt fields of a record about to
+// be inserted, unless they were already set. If force is true, UpdatedAt is
+// refreshed even if set (used by Replace, which overwrites the whole row).
+func (t *TableMeta[T]) touchCreate(be *Backend, val reflect.Value, force bool) {
+	if t.createdAt == nil && t.updatedAt == nil {
+		return
+	}
+	now := time.Now().UTC()
+	if t.createdAt != nil {
+		if f := val.Field(t.createdAt.Index); isZeroTime(f) {
+			setTime(f, now.Truncate(t.createdAt.precision(be)))
+		}
+	}
+	if t.updatedAt != nil {
+		if f := val.Field(t.updatedAt.Index); force || isZeroTime(f) {
+			setTime(f, now.Truncate(t.updatedAt.precision(be)))
+		}
+	}
+}
+
+// touchUpdate refreshes the UpdatedAt field of a record about to be updated
+// and returns its new value.
+func (t *TableMeta[T]) touchUpdate(be *Backend, val reflect.Value) any {
+	f := val.Field(t.updatedAt.Index)
+	setTime(f, t.updatedAt.now(be))
+	return f.Interface()
+}
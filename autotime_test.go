@@ -0,0 +1,107 @@
+package psql_test
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type timedArticle struct {
+	psql.Name `sql:"timed_articles"`
+	ID        uint64    `sql:",key=PRIMARY"`
+	Title     string    `sql:",type=VARCHAR,size=128"`
+	CreatedAt time.Time `sql:",autoCreateTime"`
+	UpdatedAt time.Time `sql:",autoUpdateTime"`
+}
+
+type conventionArticle struct {
+	psql.Name `sql:"convention_articles"`
+	ID        uint64 `sql:",key=PRIMARY"`
+	Title     string `sql:",type=VARCHAR,size=128"`
+	CreatedAt time.Time
+	UpdatedAt *time.Time
+}
+
+type optOutArticle struct {
+	psql.Name `sql:"optout_articles"`
+	ID        uint64    `sql:",key=PRIMARY"`
+	CreatedAt time.Time `sql:",autoCreateTime=false"`
+}
+
+func TestAutoTimeInsert(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	before := time.Now().UTC().Add(-time.Second)
+	a := &timedArticle{ID: 1, Title: "hello"}
+	require.NoError(t, psql.Insert(ctx, a))
+	assert.True(t, a.CreatedAt.After(before))
+	assert.Equal(t, a.CreatedAt, a.UpdatedAt)
+	// TS precision: microseconds
+	assert.Equal(t, a.CreatedAt, a.CreatedAt.Truncate(time.Microsecond))
+
+	// explicit values are kept
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := &timedArticle{ID: 2, CreatedAt: created}
+	require.NoError(t, psql.Insert(ctx, b))
+	assert.Equal(t, created, b.CreatedAt)
+	assert.False(t, b.UpdatedAt.IsZero())
+}
+
+func TestAutoTimeConvention(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	a := &conventionArticle{ID: 1}
+	require.NoError(t, psql.Insert(ctx, a))
+	assert.False(t, a.CreatedAt.IsZero())
+	require.NotNil(t, a.UpdatedAt)
+	// DATETIME has second precision
+	assert.Equal(t, a.CreatedAt, a.CreatedAt.Truncate(time.Second))
+
+	o := &optOutArticle{ID: 1}
+	require.NoError(t, psql.Insert(ctx, o))
+	assert.True(t, o.CreatedAt.IsZero())
+}
+
+func TestAutoTimeReplaceRefreshesUpdatedAt(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := &timedArticle{ID: 1, CreatedAt: old, UpdatedAt: old}
+	require.NoError(t, psql.Replace(ctx, a))
+	assert.Equal(t, old, a.CreatedAt)
+	assert.True(t, a.UpdatedAt.After(old))
+}
+
+func TestAutoTimeUpdateOnlyWhenChanged(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{
+			Cols: []string{"ID", "Title", "CreatedAt", "UpdatedAt"},
+			Data: [][]driver.Value{{"1", "hello", "2020-01-01 00:00:00", "2020-01-01 00:00:00"}},
+		}, nil
+	}
+
+	a, err := psql.Get[timedArticle](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	stamp := a.UpdatedAt
+	n := len(db.Queries())
+
+	// nothing changed: no query, UpdatedAt untouched
+	require.NoError(t, psql.Update(ctx, a))
+	assert.Len(t, db.Queries(), n)
+	assert.Equal(t, stamp, a.UpdatedAt)
+
+	a.Title = "changed"
+	require.NoError(t, psql.Update(ctx, a))
+	q := db.Last()
+	assert.Contains(t, q.Query, `"Title" = ?`)
+	assert.Contains(t, q.Query, `"UpdatedAt" = ?`)
+	assert.NotContains(t, q.Query, `"CreatedAt" = ?`)
+	assert.True(t, a.UpdatedAt.After(stamp))
+	assert.False(t, psql.HasChanged(a))
+}
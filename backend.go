@@ -19,6 +19,17 @@ type Backend struct {
 	checked    map[reflect.Type]bool
 	checkedLk  sync.RWMutex
 	namer      Namer // custom namer for table/column names
+
+	middlewares  []Middleware
+	interceptors []Interceptor
+	extLk        sync.RWMutex // protects middlewares and interceptors
+	tracer       Tracer
+
+	replicas      []*sql.DB
+	replicaPolicy ReplicaPolicy
+
+	cache     Cache // results of Cached fetches, created on first use if nil
+	cacheOnce sync.Once
 }
 
 // New returns a [Backend] that connects to the database identified by dsn.
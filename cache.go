@@ -0,0 +1,267 @@
+package psql
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores the results of fetches made with the [Cached] option. Values
+// must be returned as stored, and implementations must be safe for concurrent
+// use. A backend uses an in-memory LRU cache of [DefaultCacheSize] entries
+// unless another one is set with [WithCache].
+type Cache interface {
+	// Get returns the value stored for key, unless it expired.
+	Get(key string) (any, bool)
+
+	// Set stores value for key, for ttl.
+	Set(key string, value any, ttl time.Duration)
+}
+
+// DefaultCacheSize is the number of entries of the cache of backends created
+// without [WithCache]. It should be changed during setup only.
+var DefaultCacheSize = 10000
+
+// WithCache sets the cache used by fetches made with the [Cached] option.
+func WithCache(c Cache) BackendOption {
+	return func(b *Backend) {
+		b.cache = c
+	}
+}
+
+// Cached returns a [FetchOptions] caching the results of Fetch and Get for
+// ttl, for tables that are read much more often than they are written:
+//
+//	plans, err := psql.Fetch[Plan](ctx, nil, psql.Cached(time.Minute))
+//
+// Results are cached by database (backend, shard or replica), rendered query
+// and driver arguments, so a [Cache] can be shared by backends, and returned as
+// new objects on each call. Any typed write to the table (Insert, Update,
+// Delete, ...) through this process invalidates its cached results, after the
+// commit when made in a transaction. Writes made by other processes or with
+// raw queries are only seen once ttl expires.
+//
+// The cache is bypassed in transactions, for locking reads, and for queries
+// with arguments that database/sql cannot convert to driver values.
+func Cached(ttl time.Duration) *FetchOptions {
+	return &FetchOptions{CacheTTL: ttl}
+}
+
+// useCache returns true if results fetched with o in ctx can be cached.
+func (o *FetchOptions) useCache(ctx context.Context) bool {
+	return o.CacheTTL > 0 && !o.Lock && !inTx(ctx)
+}
+
+// cachedRows holds the raw values of a cached query result.
+type cachedRows struct {
+	cols []string
+	rows [][]sql.RawBytes
+}
+
+func (be *Backend) getCache() Cache {
+	be.cacheOnce.Do(func() {
+		if be.cache == nil {
+			be.cache = NewLRUCache(DefaultCacheSize)
+		}
+	})
+	return be.cache
+}
+
+// fetchCached runs the select query req, or returns its cached result.
+func (t *TableMeta[T]) fetchCached(ctx context.Context, req *QueryBuilder, ttl time.Duration) ([]*T, error) {
+	query, args, err := req.RenderArgs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t.cacheUsed.Store(true)
+
+	// arguments the key cannot represent bypass the cache
+	cache := GetBackend(ctx).getCache()
+	argsKey, cacheable := cacheArgsKey(args)
+	key := cacheSource(ctx) + "\x00" + t.table + "\x00" + strconv.FormatUint(t.cacheGen.Load(), 10) + "\x00" + query + argsKey
+	var res any
+	var ok bool
+	if cacheable {
+		res, ok = cache.Get(key)
+	}
+	if !ok {
+		rows, err := doQueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, &Error{query, err}
+		}
+		defer rows.Close()
+
+		data := &cachedRows{}
+		for rows.Next() {
+			cols, values, err := t.scanRow(rows)
+			if err != nil {
+				return nil, err
+			}
+			data.cols = cols
+			row := make([]sql.RawBytes, len(values))
+			for n, v := range values {
+				if v != nil {
+					row[n] = append(sql.RawBytes{}, v...)
+				}
+			}
+			data.rows = append(data.rows, row)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		if cacheable {
+			cache.Set(key, data, ttl)
+		}
+		res = data
+	}
+
+	data := res.(*cachedRows)
+	final := make([]*T, 0, len(data.rows))
+	for _, row := range data.rows {
+		obj := t.newobj()
+		if err := t.loadValues(obj, data.cols, row); err != nil {
+			return nil, err
+		}
+		if h, ok := any(obj).(AfterScanHook); ok {
+			if err := h.AfterScan(ctx); err != nil {
+				return nil, err
+			}
+		}
+		final = append(final, obj)
+	}
+	return final, nil
+}
+
+// cacheSource returns the part of a cache key identifying the database the
+// query of ctx is sent to: a cache may be shared by several backends, such as
+// the shards of a [ShardedBackend], and replicas may lag behind the primary.
+func cacheSource(ctx context.Context) string {
+	obj := ctx.Value(ctxDataObj)
+	if r, ok := obj.(*replicaRoute); ok {
+		obj = r.db
+	}
+	return fmt.Sprintf("%p", obj)
+}
+
+// cacheArgsKey returns the part of a cache key representing args, as
+// converted for the driver. It returns false if an argument cannot be
+// converted to a driver value.
+func cacheArgsKey(args []any) (string, bool) {
+	var b strings.Builder
+	for _, a := range args {
+		v, err := driver.DefaultParameterConverter.ConvertValue(a)
+		if err != nil {
+			return "", false
+		}
+		b.WriteByte(0)
+		switch v := v.(type) {
+		case nil:
+			b.WriteByte('n')
+		case int64:
+			b.WriteByte('i')
+			b.WriteString(strconv.FormatInt(v, 10))
+		case float64:
+			b.WriteByte('f')
+			b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+		case bool:
+			b.WriteByte('b')
+			b.WriteString(strconv.FormatBool(v))
+		case []byte:
+			b.WriteByte('x')
+			b.WriteString(hex.EncodeToString(v))
+		case string:
+			b.WriteByte('s')
+			b.WriteString(strconv.Quote(v))
+		case time.Time:
+			b.WriteByte('t')
+			b.WriteString(v.Format(time.RFC3339Nano))
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// cacheWritten invalidates the cached results of the table after op
+// succeeded, if the table ever used the cache.
+func (t *TableMeta[T]) cacheWritten(ctx context.Context, op *Operation) {
+	if !op.Type.IsWrite() || !t.cacheUsed.Load() {
+		return
+	}
+	t.cacheGen.Add(1)
+	if inTx(ctx) {
+		// results cached before the commit may not include the change, one
+		// invalidation per table is enough
+		afterCommitOnce(ctx, t, func(ctx context.Context) {
+			t.cacheGen.Add(1)
+		})
+	}
+}
+
+// NewLRUCache returns an in-memory [Cache] holding up to size entries, and
+// evicting the least recently used ones first.
+func NewLRUCache(size int) Cache {
+	return &lruCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+type lruCache struct {
+	lk    sync.Mutex
+	size  int
+	ll    *list.List // front is most recently used
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   any
+	expires time.Time
+}
+
+func (c *lruCache) Get(key string) (any, bool) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*lruEntry)
+	if time.Now().After(e.expires) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *lruCache) Set(key string, value any, ttl time.Duration) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+
+	expires := time.Now().Add(ttl)
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.value = value
+		e.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	for c.ll.Len() > c.size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*lruEntry).key)
+	}
+}
@@ -0,0 +1,178 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cachePlan struct {
+	psql.Name `sql:"cache_plans"`
+	ID        uint64 `sql:",key=PRIMARY"`
+	Label     string `sql:",type=VARCHAR,size=64"`
+}
+
+func cachePlanRows(q string, args []driver.Value) (*fakedb.Rows, error) {
+	return &fakedb.Rows{
+		Cols: []string{"ID", "Label"},
+		Data: [][]driver.Value{{int64(1), "basic"}, {int64(2), "pro"}},
+	}, nil
+}
+
+func TestCachedFetch(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = cachePlanRows
+
+	a, err := psql.Fetch[cachePlan](ctx, nil, psql.Cached(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, a, 2)
+	b, err := psql.Fetch[cachePlan](ctx, nil, psql.Cached(time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, db.Queries(), 1)
+	assert.Equal(t, a, b)
+	assert.NotSame(t, a[0], b[0], "each call returns new objects")
+	assert.False(t, psql.HasChanged(b[0]))
+
+	// other arguments are cached separately
+	_, err = psql.Fetch[cachePlan](ctx, map[string]any{"ID": 2}, psql.Cached(time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, db.Queries(), 2)
+
+	// without the option the cache is not used
+	_, err = psql.Fetch[cachePlan](ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, db.Queries(), 3)
+
+	p, err := psql.Get[cachePlan](ctx, map[string]any{"ID": 1}, psql.Cached(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "basic", p.Label)
+	_, err = psql.Get[cachePlan](ctx, map[string]any{"ID": 1}, psql.Cached(time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, db.Queries(), 4)
+}
+
+func TestCachedInvalidation(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = cachePlanRows
+
+	fetch := func() {
+		_, err := psql.Fetch[cachePlan](ctx, nil, psql.Cached(time.Minute))
+		require.NoError(t, err)
+	}
+
+	fetch()
+	require.NoError(t, psql.Insert(ctx, &cachePlan{ID: 3, Label: "team"}))
+	n := len(db.Queries())
+	fetch()
+	assert.Len(t, db.Queries(), n+1, "Insert invalidates")
+
+	_, err := psql.Delete[cachePlan](ctx, map[string]any{"ID": 3})
+	require.NoError(t, err)
+	n = len(db.Queries())
+	fetch()
+	assert.Len(t, db.Queries(), n+1, "Delete invalidates")
+
+	// in a transaction the cache is bypassed, and invalidated on commit
+	require.NoError(t, psql.Tx(ctx, func(ctx context.Context) error {
+		n = len(db.Queries())
+		if _, err := psql.Fetch[cachePlan](ctx, nil, psql.Cached(time.Minute)); err != nil {
+			return err
+		}
+		assert.Len(t, db.Queries(), n+1)
+		return psql.Update(ctx, &cachePlan{ID: 1, Label: "starter"})
+	}))
+	n = len(db.Queries())
+	fetch()
+	assert.Len(t, db.Queries(), n+1, "Update in a transaction invalidates")
+	fetch()
+	assert.Len(t, db.Queries(), n+1)
+}
+
+func TestWithCache(t *testing.T) {
+	f := &fakedb.DB{OnQuery: cachePlanRows}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	cache := psql.NewLRUCache(1)
+	ctx := psql.NewBackend(psql.EngineSQLite, db, psql.WithCache(cache)).Plug(context.Background())
+
+	fetch := func(where any) {
+		_, err := psql.Fetch[cachePlan](ctx, where, psql.Cached(time.Minute))
+		require.NoError(t, err)
+	}
+
+	fetch(map[string]any{"ID": 1})
+	fetch(map[string]any{"ID": 1})
+	assert.Len(t, f.Queries(), 1)
+	fetch(map[string]any{"ID": 2})
+	fetch(map[string]any{"ID": 1})
+	assert.Len(t, f.Queries(), 3, "size 1 only keeps the last entry")
+}
+
+func TestCachedSharedBetweenBackends(t *testing.T) {
+	cache := psql.NewLRUCache(10)
+	var ctxs []context.Context
+	var fakes []*fakedb.DB
+	for _, label := range []string{"basic", "pro"} {
+		f := &fakedb.DB{OnQuery: func(q string, args []driver.Value) (*fakedb.Rows, error) {
+			return &fakedb.Rows{Cols: []string{"ID", "Label"}, Data: [][]driver.Value{{int64(1), label}}}, nil
+		}}
+		db := sql.OpenDB(f)
+		t.Cleanup(func() { db.Close() })
+		fakes = append(fakes, f)
+		ctxs = append(ctxs, psql.NewBackend(psql.EngineSQLite, db, psql.WithCache(cache)).Plug(context.Background()))
+	}
+
+	for range 2 {
+		for n, label := range []string{"basic", "pro"} {
+			p, err := psql.Get[cachePlan](ctxs[n], map[string]any{"ID": 1}, psql.Cached(time.Minute))
+			require.NoError(t, err)
+			assert.Equal(t, label, p.Label, "each backend has its own entries")
+		}
+	}
+	assert.Len(t, fakes[0].Queries(), 1)
+	assert.Len(t, fakes[1].Queries(), 1)
+}
+
+func TestLRUCache(t *testing.T) {
+	c := psql.NewLRUCache(2)
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Minute)
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	c.Set("c", 3, time.Minute)
+	_, ok = c.Get("b")
+	assert.False(t, ok, "least recently used entry is evicted")
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	c.Set("d", 4, -time.Second)
+	_, ok = c.Get("d")
+	assert.False(t, ok, "expired")
+}
+
+func TestCachedKeyArgs(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = cachePlanRows
+
+	fetch := func(v any) {
+		_, err := psql.Fetch[cachePlan](ctx, map[string]any{"Label": v}, psql.Cached(time.Minute))
+		require.NoError(t, err)
+	}
+	fetch([]byte("pro"))
+	fetch([]byte("pro"))
+	assert.Len(t, db.Queries(), 1)
+	fetch("pro")
+	assert.Len(t, db.Queries(), 2, "arguments are keyed by driver type")
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fetch(at)
+	fetch(at)
+	assert.Len(t, db.Queries(), 3)
+}
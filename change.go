@@ -1,9 +1,14 @@
 package psql
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"reflect"
+
+	"github.com/KarpelesLab/typutil"
 )
 
 // HasChanged returns true if the object has been modified since it was last loaded
@@ -15,30 +20,123 @@ func HasChanged[T any](obj *T) bool {
 
 func (t *TableMeta[T]) HasChanged(obj *T) bool {
 	st := t.rowstate(obj)
-	if st == nil {
-		// no main key → always report changed
-		slog.Warn(fmt.Sprintf("[psql] HasChanged but no state"), "event", "psql:change:state_missing", "table", t.table)
-		return true
-	}
 	if !st.init {
 		// uninitialized → no state
 		slog.Warn(fmt.Sprintf("[psql] HasChanged on non initialized value"), "event", "psql:change:state_uninit", "table", t.table)
 		return true
 	}
 
+	return len(t.Changes(obj)) > 0
+}
+
+// Change holds the stored and current values of a column, as returned by
+// [Changes].
+type Change struct {
+	Old any // value last loaded from or saved to the database
+	New any // current value of the object
+}
+
+// Changes returns the columns of obj modified since it was last loaded from
+// or saved to the database, with their old and new values. JSON columns
+// report their old value as a [json.RawMessage].
+//
+// Objects that were never loaded report all their columns with a nil Old
+// value, since [Update] writes them all. Changes can be called from a
+// [BeforeUpdateHook] to inspect what is about to be written. It returns nil
+// if obj is nil.
+func Changes[T any](obj *T) map[string]Change {
+	return Table[T]().Changes(obj)
+}
+
+func (t *TableMeta[T]) Changes(obj *T) map[string]Change {
+	if obj == nil {
+		return nil
+	}
 	val := reflect.ValueOf(obj).Elem()
+	st := t.rowstate(obj)
+	res := make(map[string]Change)
 
-	for _, col := range t.fields {
-		// grab state value
-		stv, ok := st.val[col.Column]
+	for _, f := range t.fields {
+		newv := val.Field(f.Index).Interface()
+		if st == nil || !st.init {
+			res[f.Column] = Change{New: newv}
+			continue
+		}
+		stv, ok := st.val[f.Column]
 		if !ok {
-			// can't check because that column wasn't fetched → bad
-			return true
+			// column wasn't fetched
+			res[f.Column] = Change{New: newv}
+			continue
 		}
-		if !reflect.DeepEqual(val.Field(col.Index).Interface(), stv) {
-			return true
+		if fieldChanged(f, stv, newv) {
+			if s, ok := stv.(string); ok && f.Attrs["format"] == "json" {
+				stv = json.RawMessage(s)
+			}
+			res[f.Column] = Change{Old: stv, New: newv}
 		}
 	}
+	return res
+}
 
-	return false
+// ResetChanges marks the current values of obj as stored in the database, so
+// that [HasChanged] reports false and [Update] only writes later changes.
+func ResetChanges[T any](obj *T) {
+	Table[T]().ResetChanges(obj)
+}
+
+func (t *TableMeta[T]) ResetChanges(obj *T) {
+	st := t.rowstate(obj)
+	val := reflect.ValueOf(obj).Elem()
+	st.init = true
+	st.val = make(map[string]any, len(t.fields))
+	for _, f := range t.fields {
+		st.val[f.Column] = stateValue(f, val.Field(f.Index).Interface())
+	}
+}
+
+// Reload refreshes obj from the database by its main key, discarding any
+// local change. Soft deleted rows are reloaded too. The row is always read
+// from the primary, never from a replica that may lag behind. It returns
+// [os.ErrNotExist] if the row no longer exists.
+func Reload[T any](ctx context.Context, obj *T) error {
+	return Table[T]().Reload(ctx, obj)
+}
+
+func (t *TableMeta[T]) Reload(ctx context.Context, obj *T) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	if t.mainKey == nil {
+		return errors.New("cannot reload objects without a unique key")
+	}
+	val := reflect.ValueOf(obj).Elem()
+	where := make(map[string]any, len(t.mainKey.Fields))
+	for _, col := range t.mainKey.Fields {
+		where[col] = val.Field(t.fldcol[col].Index).Interface()
+	}
+	return t.FetchOne(UsePrimary(ctx), obj, where, IncludeDeleted())
+}
+
+// fieldChanged returns true if newv differs from the state value stv of f.
+func fieldChanged(f *StructField, stv, newv any) bool {
+	if s, ok := stv.(string); ok && f.Attrs["format"] == "json" {
+		// state stores raw JSON; compare by re-marshaling
+		newJSON, _ := json.Marshal(newv)
+		return string(newJSON) != s
+	}
+	return !reflect.DeepEqual(newv, stv)
+}
+
+// stateValue returns v as stored in the row state for f: JSON columns are
+// stored encoded, and other values are cloned so that later modifications of
+// the object are detected.
+func stateValue(f *StructField, v any) any {
+	if f.Attrs["format"] == "json" {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return nil
+		}
+		return string(buf)
+	}
+	return typutil.DeepClone(v)
 }
@@ -0,0 +1,133 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type changeItem struct {
+	psql.Name `sql:"change_items"`
+	ID        uint64 `sql:",key=PRIMARY"`
+	Label     string `sql:",type=VARCHAR,size=64"`
+	Note      *string
+	Tags      []string `sql:",format=json,type=TEXT"`
+
+	seen map[string]psql.Change
+}
+
+func (c *changeItem) BeforeUpdate(ctx context.Context) error {
+	c.seen = psql.Changes(c)
+	return nil
+}
+
+func changeItemRows(label string) func(q string, args []driver.Value) (*fakedb.Rows, error) {
+	return func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{
+			Cols: []string{"ID", "Label", "Note", "Tags"},
+			Data: [][]driver.Value{{int64(1), label, nil, `["a"]`}},
+		}, nil
+	}
+}
+
+func TestChanges(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = changeItemRows("first")
+
+	item, err := psql.Get[changeItem](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	assert.Empty(t, psql.Changes(item), "NULL and JSON columns are unchanged")
+	assert.False(t, psql.HasChanged(item))
+
+	item.Label = "second"
+	item.Tags = append(item.Tags, "b")
+	changes := psql.Changes(item)
+	assert.Equal(t, map[string]psql.Change{
+		"Label": {Old: "first", New: "second"},
+		"Tags":  {Old: json.RawMessage(`["a"]`), New: []string{"a", "b"}},
+	}, changes)
+
+	require.NoError(t, psql.Update(ctx, item))
+	assert.Equal(t, changes, item.seen, "visible from BeforeUpdate")
+	assert.Empty(t, psql.Changes(item))
+}
+
+func TestChangesWithoutState(t *testing.T) {
+	changes := psql.Changes(&changeItem{ID: 1, Label: "x"})
+	assert.Len(t, changes, 4)
+	assert.Nil(t, changes["Label"].Old)
+	assert.Equal(t, "x", changes["Label"].New)
+	assert.Nil(t, psql.Changes[changeItem](nil))
+}
+
+func TestResetChanges(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	item := &changeItem{ID: 1, Label: "x", Tags: []string{"a"}}
+	psql.ResetChanges(item)
+	assert.False(t, psql.HasChanged(item))
+
+	require.NoError(t, psql.Update(ctx, item))
+	assert.Empty(t, db.Queries(), "nothing to write")
+
+	item.Tags[0] = "b"
+	assert.Equal(t, []string{"Tags"}, keys(psql.Changes(item)))
+}
+
+func TestReload(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = changeItemRows("stored")
+
+	item := &changeItem{ID: 1, Label: "local"}
+	require.NoError(t, psql.Reload(ctx, item))
+	assert.Equal(t, "stored", item.Label)
+	assert.Equal(t, []string{"a"}, item.Tags)
+	assert.False(t, psql.HasChanged(item))
+	assert.Contains(t, db.Last().Query, `WHERE ("ID"=?)`)
+	assert.Equal(t, []driver.Value{int64(1)}, db.Last().Args)
+
+	db.OnQuery = nil
+	assert.True(t, psql.IsNotExist(psql.Reload(ctx, item)))
+}
+
+func keys[V any](m map[string]V) []string {
+	var res []string
+	for k := range m {
+		res = append(res, k)
+	}
+	return res
+}
+
+// plainItem has no psql.Name or psql.Key field to hold its row state.
+type plainItem struct {
+	ID    uint64 `sql:",key=PRIMARY"`
+	Label string `sql:",type=VARCHAR,size=64"`
+	Count int64
+}
+
+func TestChangesPlainStruct(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{Cols: []string{"ID", "Label", "Count"}, Data: [][]driver.Value{{int64(1), "a", int64(3)}}}, nil
+	}
+
+	item, err := psql.Get[plainItem](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	assert.False(t, psql.HasChanged(item))
+
+	item.Count = 4
+	assert.Equal(t, map[string]psql.Change{"Count": {Old: int64(3), New: int64(4)}}, psql.Changes(item))
+
+	require.NoError(t, psql.Update(ctx, item))
+	assert.Equal(t, `UPDATE "Plain_Item" SET "Count" = ? WHERE "ID" = ?`, db.Last().Query)
+	assert.False(t, psql.HasChanged(item))
+
+	copied := *item
+	assert.True(t, psql.HasChanged(&copied), "state belongs to the original object")
+}
@@ -10,6 +10,7 @@ type ctxData int
 const (
 	ctxDataObj ctxData = iota
 	ctxValueObjFetch
+	ctxUsePrimary
 )
 
 type ctxValueObj struct {
@@ -68,44 +69,72 @@ func ContextTx(ctx context.Context, tx *TxProxy) context.Context {
 //	    return nil
 //	})
 func Tx(ctx context.Context, cb func(ctx context.Context) error) error {
-	tx, err := BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
-	ctx = ContextTx(ctx, tx)
-	err = cb(ctx)
-	if err == nil {
-		return tx.Commit()
-	}
-	return err
+	return TxWith(ctx, TxOpts{}, cb)
 }
 
 // BeginTx starts a new transaction. If the context already contains a transaction,
 // a nested transaction is created using a SQL savepoint. Use [ContextTx] to attach
 // the returned [TxProxy] to a context for use with psql operations.
 func BeginTx(ctx context.Context, opts *sql.TxOptions) (*TxProxy, error) {
+	_, tx, err := beginTx(ctx, txOptsFromSQL(opts))
+	return tx, err
+}
+
+// beginTx starts a transaction like [BeginTx], within a tracing span. The
+// returned context carries the span, so that operations run in the
+// transaction are nested under it.
+func beginTx(ctx context.Context, opts *TxOpts) (context.Context, *TxProxy, error) {
+	var attrs []Attr
+	if opts != nil && opts.Label != "" {
+		attrs = append(attrs, Attr{AttrTxLabel, opts.Label})
+	}
+	ctx, sp := startSpan(ctx, "psql.tx", attrs...)
+	tx, err := doBeginTx(ctx, opts)
+	if err != nil {
+		endSpan(sp, err)
+		return ctx, nil, err
+	}
+	if sp != nil {
+		sp.SetAttrs(Attr{AttrTxDepth, tx.depth})
+		tx.span = sp
+	}
+	return ctx, tx, nil
+}
+
+func doBeginTx(ctx context.Context, opts *TxOpts) (*TxProxy, error) {
 	obj := ctx.Value(ctxDataObj)
 	if obj == nil {
-		return newTxCtrl(GetBackend(ctx).DB().BeginTx(ctx, opts))
+		return startTx(ctx, GetBackend(ctx).DB(), opts)
 	}
 
 	switch o := obj.(type) {
 	case *sql.Conn:
-		return newTxCtrl(o.BeginTx(ctx, opts))
+		return startTx(ctx, o, opts)
 	case *sql.DB:
-		return newTxCtrl(o.BeginTx(ctx, opts))
+		return startTx(ctx, o, opts)
 	case *Backend:
-		return newTxCtrl(o.db.BeginTx(ctx, opts))
+		return startTx(ctx, o.db, opts)
+	case *replicaRoute:
+		return startTx(ctx, GetBackend(ctx).DB(), opts)
+	case *ShardedBackend:
+		be, err := o.contextShard(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := startTx(ctx, be.db, opts)
+		if err != nil {
+			return nil, err
+		}
+		// remembered to reject operations on other shards, see txShard
+		tx.ctrl.sharded = o
+		tx.ctrl.shard = be
+		return tx, nil
 	case *TxProxy:
-		return o.BeginTx(ctx, opts)
-	case interface {
-		BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
-	}:
-		return newTxCtrl(o.BeginTx(ctx, opts))
+		return o.ctrl.beginSubTx(ctx, opts)
+	case TxBeginner:
+		return startTx(ctx, o, opts)
 	default:
-		return newTxCtrl(GetBackend(ctx).DB().BeginTx(ctx, opts))
+		return startTx(ctx, GetBackend(ctx).DB(), opts)
 	}
 }
 
@@ -145,7 +174,10 @@ func EscapeTx(ctx context.Context) (context.Context, bool) {
 }
 
 // GetBackend will attempt to find a backend in the provided context and return it, or it will
-// return DefaultBackend if no backend was found.
+// return DefaultBackend if no backend was found. If the context holds a [ShardedBackend], the
+// shard matching the key set with [WithShardKey], or its default shard, is returned. Without
+// either, the first shard is returned so that settings common to all shards (engine, namer)
+// can be accessed, but statements run through psql fail with [ErrShardKeyRequired].
 func GetBackend(ctx context.Context) *Backend {
 	for {
 		if ctx == nil {
@@ -158,8 +190,11 @@ func GetBackend(ctx context.Context) *Backend {
 		}
 		objV := obj.(*ctxValueObj)
 
-		if be, ok := objV.obj.(*Backend); ok {
-			return be
+		switch o := objV.obj.(type) {
+		case *Backend:
+			return o
+		case *ShardedBackend:
+			return o.backendFor(ctx)
 		}
 
 		// we need to continue
@@ -169,7 +204,12 @@ func GetBackend(ctx context.Context) *Backend {
 
 // ExecContext executes a query (INSERT, UPDATE, DELETE, etc.) using whatever database
 // object is attached to the context (transaction, connection, or backend).
+// Registered [Interceptor] instances are invoked around the query.
 func ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return intercept(ctx, QueryExec, query, args, execContext, resultRowsAffected)
+}
+
+func execContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
 	obj := ctx.Value(ctxDataObj)
 	if obj == nil {
 		debugLog(ctx, "Exec on DB: %s %v", query, args)
@@ -192,6 +232,17 @@ func ExecContext(ctx context.Context, query string, args ...any) (sql.Result, er
 	case *Backend:
 		debugLog(ctx, "Exec on Backend: %s %v", query, args)
 		return o.db.ExecContext(ctx, query, args...)
+	case *replicaRoute:
+		// never write to a replica
+		debugLog(ctx, "Exec on DB (primary): %s %v", query, args)
+		return GetBackend(ctx).DB().ExecContext(ctx, query, args...)
+	case *ShardedBackend:
+		be, err := o.contextShard(ctx)
+		if err != nil {
+			return nil, err
+		}
+		debugLog(ctx, "Exec on shard: %s %v", query, args)
+		return be.db.ExecContext(ctx, query, args...)
 	case interface {
 		ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 	}:
@@ -205,6 +256,10 @@ func ExecContext(ctx context.Context, query string, args ...any) (sql.Result, er
 }
 
 func doQueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return intercept(ctx, QueryRows, query, args, queryContext, nil)
+}
+
+func queryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
 	obj := ctx.Value(ctxDataObj)
 	if obj == nil {
 		debugLog(ctx, "Query on DB: %s %v", query, args)
@@ -227,6 +282,16 @@ func doQueryContext(ctx context.Context, query string, args ...any) (*sql.Rows,
 	case *Backend:
 		debugLog(ctx, "Query on Backend: %s %v", query, args)
 		return o.db.QueryContext(ctx, query, args...)
+	case *replicaRoute:
+		debugLog(ctx, "Query on replica: %s %v", query, args)
+		return o.db.QueryContext(ctx, query, args...)
+	case *ShardedBackend:
+		be, err := o.contextShard(ctx)
+		if err != nil {
+			return nil, err
+		}
+		debugLog(ctx, "Query on shard: %s %v", query, args)
+		return be.db.QueryContext(ctx, query, args...)
 	case interface {
 		QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
 	}:
@@ -240,6 +305,12 @@ func doQueryContext(ctx context.Context, query string, args ...any) (*sql.Rows,
 }
 
 func doPrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return intercept(ctx, QueryPrepare, query, nil, func(ctx context.Context, query string, _ ...any) (*sql.Stmt, error) {
+		return prepareContext(ctx, query)
+	}, nil)
+}
+
+func prepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
 	obj := ctx.Value(ctxDataObj)
 	if obj == nil {
 		debugLog(ctx, "Prepare on DB: %s", query)
@@ -262,6 +333,16 @@ func doPrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
 	case *Backend:
 		debugLog(ctx, "Prepare on Backend: %s", query)
 		return o.db.PrepareContext(ctx, query)
+	case *replicaRoute:
+		debugLog(ctx, "Prepare on DB (primary): %s", query)
+		return GetBackend(ctx).DB().PrepareContext(ctx, query)
+	case *ShardedBackend:
+		be, err := o.contextShard(ctx)
+		if err != nil {
+			return nil, err
+		}
+		debugLog(ctx, "Prepare on shard: %s", query)
+		return be.db.PrepareContext(ctx, query)
 	case interface {
 		PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
 	}:
@@ -12,6 +12,19 @@ func Count[T any](ctx context.Context, where any, opts ...*FetchOptions) (int, e
 }
 
 func (t *TableMeta[T]) Count(ctx context.Context, where any, opts ...*FetchOptions) (int, error) {
+	if t == nil {
+		return 0, ErrNotReady
+	}
+	var res int
+	err := t.runOp(ctx, &Operation{Type: OpCount, Where: where, Options: resolveFetchOpts(opts)}, func(ctx context.Context, op *Operation) error {
+		n, err := t.count(ctx, op.Where, op.Options)
+		res += n // accumulate when fanned out over shards
+		return err
+	})
+	return res, err
+}
+
+func (t *TableMeta[T]) count(ctx context.Context, where any, opts ...*FetchOptions) (int, error) {
 	if t == nil {
 		return 0, ErrNotReady
 	}
@@ -24,6 +37,9 @@ func (t *TableMeta[T]) Count(ctx context.Context, where any, opts ...*FetchOptio
 		req = req.Where(where)
 	}
 	t.applySoftDelete(req, opt)
+	if err := t.applyTenant(ctx, req); err != nil {
+		return 0, err
+	}
 	req = req.Apply(opt.Scopes...)
 
 	// run query
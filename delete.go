@@ -3,8 +3,10 @@ package psql
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
+	"reflect"
 	"time"
 )
 
@@ -17,6 +19,19 @@ func Delete[T any](ctx context.Context, where any, opts ...*FetchOptions) (sql.R
 }
 
 func (t *TableMeta[T]) Delete(ctx context.Context, where any, opts ...*FetchOptions) (sql.Result, error) {
+	if t == nil {
+		return nil, ErrNotReady
+	}
+	op := &Operation{Type: OpDelete, Where: where, Options: resolveFetchOpts(opts)}
+	err := t.runOp(ctx, op, func(ctx context.Context, op *Operation) error {
+		var err error
+		op.Result, err = t.delete(ctx, op.Where, op.Options)
+		return err
+	})
+	return op.Result, err
+}
+
+func (t *TableMeta[T]) delete(ctx context.Context, where any, opts ...*FetchOptions) (sql.Result, error) {
 	if t == nil {
 		return nil, ErrNotReady
 	}
@@ -34,6 +49,9 @@ func (t *TableMeta[T]) Delete(ctx context.Context, where any, opts ...*FetchOpti
 		}
 		// Only soft-delete records that aren't already deleted
 		req = req.Where(map[string]any{t.softDelete.Column: nil})
+		if err := t.applyTenant(ctx, req); err != nil {
+			return nil, err
+		}
 
 		if opt.LimitCount > 0 {
 			if opt.LimitStart > 0 {
@@ -43,11 +61,18 @@ func (t *TableMeta[T]) Delete(ctx context.Context, where any, opts ...*FetchOpti
 			}
 		}
 
+		before, err := t.historyBefore(ctx, where, opt, false)
+		if err != nil {
+			return nil, err
+		}
 		res, err := req.ExecQuery(ctx)
 		if err != nil {
 			slog.ErrorContext(ctx, err.Error()+"\n"+debugStack(), "event", "psql:soft_delete:run_fail", "psql.table", t.table)
 			return nil, err
 		}
+		if err := t.historyAfter(ctx, "delete", before); err != nil {
+			return nil, err
+		}
 		return res, nil
 	}
 
@@ -56,6 +81,9 @@ func (t *TableMeta[T]) Delete(ctx context.Context, where any, opts ...*FetchOpti
 	if where != nil {
 		req = req.Where(where)
 	}
+	if err := t.applyTenant(ctx, req); err != nil {
+		return nil, err
+	}
 
 	if opt.LimitCount > 0 {
 		if opt.LimitStart > 0 {
@@ -65,12 +93,20 @@ func (t *TableMeta[T]) Delete(ctx context.Context, where any, opts ...*FetchOpti
 		}
 	}
 
+	before, err := t.historyBefore(ctx, where, opt, true)
+	if err != nil {
+		return nil, err
+	}
+
 	// run query
 	res, err := req.ExecQuery(ctx)
 	if err != nil {
 		slog.ErrorContext(ctx, err.Error()+"\n"+debugStack(), "event", "psql:delete:run_fail", "psql.table", t.table)
 		return nil, err
 	}
+	if err := t.historyAfter(ctx, "delete", before); err != nil {
+		return nil, err
+	}
 	return res, nil
 }
 
@@ -103,3 +139,173 @@ func (t *TableMeta[T]) DeleteOne(ctx context.Context, where any, opts ...*FetchO
 
 	return tx.Commit()
 }
+
+// DeleteObj deletes the given objects by their main key. If the table has a
+// soft delete field, the records are soft-deleted and the field is set on the
+// objects; use [ForceDeleteObj] to bypass this. Objects whose record is
+// already soft-deleted are left unchanged.
+//
+// Fires [BeforeDeleteHook] and [AfterDeleteHook] if implemented. If the table
+// has a version field, the deletion only applies when the stored version
+// matches and [ErrStaleObject] is returned otherwise. Soft deletion bumps the
+// version.
+func DeleteObj[T any](ctx context.Context, target ...*T) error {
+	if len(target) == 0 {
+		return nil
+	}
+
+	return Table[T]().DeleteObj(ctx, target...)
+}
+
+// ForceDeleteObj is like [DeleteObj] but always performs a hard DELETE, even
+// if the table uses soft delete.
+func ForceDeleteObj[T any](ctx context.Context, target ...*T) error {
+	if len(target) == 0 {
+		return nil
+	}
+
+	return Table[T]().ForceDeleteObj(ctx, target...)
+}
+
+func (t *TableMeta[T]) DeleteObj(ctx context.Context, target ...*T) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	return t.runOp(ctx, &Operation{Type: OpDeleteObj, Objects: objectsOf(target)}, func(ctx context.Context, op *Operation) error {
+		targets, err := opTargets[T](op)
+		if err != nil {
+			return err
+		}
+		return t.deleteObjs(ctx, t.softDelete != nil, targets)
+	})
+}
+
+func (t *TableMeta[T]) ForceDeleteObj(ctx context.Context, target ...*T) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	op := &Operation{Type: OpDeleteObj, Objects: objectsOf(target), Options: &FetchOptions{HardDelete: true}}
+	return t.runOp(ctx, op, func(ctx context.Context, op *Operation) error {
+		targets, err := opTargets[T](op)
+		if err != nil {
+			return err
+		}
+		return t.deleteObjs(ctx, false, targets)
+	})
+}
+
+func (t *TableMeta[T]) deleteObjs(ctx context.Context, soft bool, targets []*T) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	t.check(ctx)
+	if t.mainKey == nil {
+		return errors.New("cannot delete objects without a unique key")
+	}
+
+	be := GetBackend(ctx)
+
+	for _, obj := range targets {
+		if h, ok := any(obj).(BeforeDeleteHook); ok {
+			if err := h.BeforeDelete(ctx); err != nil {
+				return err
+			}
+		}
+
+		val := reflect.ValueOf(obj).Elem()
+		where := make(map[string]any)
+		for _, col := range t.mainKey.Fields {
+			where[col] = val.Field(t.fldcol[col].Index).Interface()
+		}
+		if t.version != nil {
+			where[t.version.Column] = val.Field(t.version.Index).Interface()
+		}
+		if t.tenant != nil {
+			where[t.tenant.Column] = val.Field(t.tenant.Index).Interface()
+		}
+
+		var req *QueryBuilder
+		var now time.Time
+		var nextVersion reflect.Value
+		if soft {
+			now = t.softDelete.now(be)
+			set := map[string]any{t.softDelete.Column: now}
+			if t.version != nil {
+				// soft deletion is a change of the row like any update
+				nextVersion = t.nextVersion(be, val.Field(t.version.Index))
+				set[t.version.Column] = nextVersion.Interface()
+			}
+			req = B().Update(t.FormattedName(be)).
+				Set(set).
+				Where(where).
+				Where(map[string]any{t.softDelete.Column: nil})
+		} else {
+			req = B().Delete().From(t.FormattedName(be)).Where(where)
+		}
+
+		res, err := req.ExecQuery(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, err.Error()+"\n"+debugStack(), "event", "psql:delete_obj:run_fail", "psql.table", t.table)
+			return err
+		}
+		if soft || t.version != nil {
+			n, err := res.RowsAffected()
+			if err != nil {
+				return err
+			}
+			if n == 0 && soft {
+				// already soft deleted, or stale
+				if t.version != nil {
+					cnt, err := t.Count(ctx, where, IncludeDeleted())
+					if err != nil {
+						return err
+					}
+					if cnt == 0 {
+						return t.staleError()
+					}
+				}
+				continue
+			}
+			if n == 0 {
+				return t.staleError()
+			}
+		}
+
+		st := t.rowstate(obj)
+		if t.history {
+			var err error
+			if soft {
+				err = t.recordHistory(ctx, "delete", val, map[string]any{t.softDelete.Column: nil}, map[string]any{t.softDelete.Column: now})
+			} else {
+				err = t.recordHistory(ctx, "delete", val, t.storedValues(st, val), nil)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if soft {
+			f := val.Field(t.softDelete.Index)
+			setTime(f, now)
+			if st.init {
+				st.val[t.softDelete.Column] = stateValue(t.softDelete, f.Interface())
+			}
+			if t.version != nil {
+				val.Field(t.version.Index).Set(nextVersion)
+				if st.init {
+					st.val[t.version.Column] = stateValue(t.version, nextVersion.Interface())
+				}
+			}
+		} else if st != nil {
+			// the row is gone, a later Update must write everything
+			st.init = false
+			st.val = nil
+		}
+
+		if h, ok := any(obj).(AfterDeleteHook); ok {
+			if err := h.AfterDelete(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type hookedDoc struct {
+	psql.Name `sql:"hooked_docs"`
+	ID        uint64 `sql:",key=PRIMARY"`
+	Title     string `sql:",type=VARCHAR,size=128"`
+	events    []string
+	veto      bool
+}
+
+func (d *hookedDoc) BeforeDelete(ctx context.Context) error {
+	if d.veto {
+		return errors.New("vetoed")
+	}
+	d.events = append(d.events, "before")
+	return nil
+}
+
+func (d *hookedDoc) AfterDelete(ctx context.Context) error {
+	d.events = append(d.events, "after")
+	return nil
+}
+
+func TestDeleteObjHard(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	d := &hookedDoc{ID: 3}
+	require.NoError(t, psql.DeleteObj(ctx, d))
+	q := db.Last()
+	assert.True(t, strings.HasPrefix(q.Query, `DELETE FROM "hooked_docs" WHERE`))
+	assert.Contains(t, q.Query, `"ID"=`)
+	assert.Equal(t, []string{"before", "after"}, d.events)
+
+	n := len(db.Queries())
+	vetoed := &hookedDoc{ID: 4, veto: true}
+	assert.Error(t, psql.DeleteObj(ctx, vetoed))
+	assert.Len(t, db.Queries(), n, "vetoed delete must not run")
+}
+
+func TestDeleteObjSoft(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	o := &partialOrder{ID: 9}
+	require.NoError(t, psql.DeleteObj(ctx, o))
+	q := db.Last()
+	assert.True(t, strings.HasPrefix(q.Query, `UPDATE "partial_orders" SET "DeletedAt"=`))
+	assert.Contains(t, q.Query, `"DeletedAt" IS NULL`)
+	require.NotNil(t, o.DeletedAt)
+
+	require.NoError(t, psql.ForceDeleteObj(ctx, o))
+	assert.True(t, strings.HasPrefix(db.Last().Query, `DELETE FROM "partial_orders"`))
+}
+
+func TestDeleteObjStale(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnExec = func(q string, args []driver.Value) (driver.Result, error) {
+		return driver.RowsAffected(0), nil
+	}
+
+	err := psql.DeleteObj(ctx, &versionedDoc{ID: 1, Version: 2})
+	assert.True(t, errors.Is(err, psql.ErrStaleObject))
+	assert.Contains(t, db.Last().Query, `"Version"=`)
+}
+
+type versionedNote struct {
+	psql.Name `sql:"versioned_notes"`
+	ID        uint64     `sql:",key=PRIMARY"`
+	Version   int64      `sql:",version"`
+	DeletedAt *time.Time `sql:",import=TS"`
+}
+
+func TestDeleteObjSoftVersion(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	n := &versionedNote{ID: 1, Version: 2}
+	require.NoError(t, psql.DeleteObj(ctx, n))
+	assert.Contains(t, db.Last().Query, `"Version"=?`)
+	assert.Equal(t, int64(3), n.Version, "soft deletion bumps the version")
+	require.NotNil(t, n.DeletedAt)
+
+	// already soft deleted: the row still exists with this version
+	db.OnExec = func(q string, args []driver.Value) (driver.Result, error) {
+		return driver.RowsAffected(0), nil
+	}
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{Cols: []string{"COUNT(*)"}, Data: [][]driver.Value{{int64(1)}}}, nil
+	}
+	again := &versionedNote{ID: 1, Version: 3}
+	require.NoError(t, psql.DeleteObj(ctx, again))
+	assert.Nil(t, again.DeletedAt, "unchanged when no row was affected")
+	assert.Equal(t, int64(3), again.Version)
+
+	// no row with this version: stale
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{Cols: []string{"COUNT(*)"}, Data: [][]driver.Value{{int64(0)}}}, nil
+	}
+	assert.ErrorIs(t, psql.DeleteObj(ctx, &versionedNote{ID: 1, Version: 1}), psql.ErrStaleObject)
+}
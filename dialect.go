@@ -2,6 +2,7 @@ package psql
 
 import (
 	"context"
+	"database/sql"
 	"strings"
 )
 
@@ -49,12 +50,32 @@ type UpsertRenderer interface {
 	InsertIgnoreSQL(tableName, fldStr, placeholders string) string
 }
 
+// ConflictUpdateRenderer handles engine-specific INSERT ... ON CONFLICT DO
+// UPDATE syntax used by [Upsert]. conflict and update are column names; extra
+// holds already rendered SET expressions to append to the update clause.
+type ConflictUpdateRenderer interface {
+	UpsertSQL(tableName, fldStr, placeholders string, conflict, update, extra []string) string
+}
+
 // ReturningRenderer is implemented by dialects that support RETURNING clauses
 // on INSERT/REPLACE/UPDATE statements (e.g., PostgreSQL).
 type ReturningRenderer interface {
 	SupportsReturning() bool
 }
 
+// TxStarter is implemented by dialects that start transactions themselves, to
+// apply [TxOpts] the driver does not support through sql.TxOptions (e.g. SET
+// TRANSACTION on MySQL or BEGIN IMMEDIATE on SQLite). db is the *sql.DB or
+// *sql.Conn the transaction must be started on.
+type TxStarter interface {
+	StartTx(ctx context.Context, db TxBeginner, opts TxOpts) (*sql.Tx, error)
+}
+
+// TxBeginner is implemented by *sql.DB and *sql.Conn.
+type TxBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
 // ErrorClassifier handles engine-specific error interpretation.
 type ErrorClassifier interface {
 	ErrorNumber(err error) uint16
@@ -23,6 +23,10 @@ func defaultExportArg(v any) any {
 	if v == nil {
 		return nil
 	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		// typed nil pointers (e.g. a nil *time.Time) would panic as Stringer
+		return nil
+	}
 	switch val := v.(type) {
 	case fmt.Stringer:
 		return val.String()
@@ -2,6 +2,7 @@ package psql_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/portablesql/psql"
 	"github.com/stretchr/testify/assert"
@@ -33,6 +34,13 @@ func TestDefaultExportArgNilPointer(t *testing.T) {
 	assert.Nil(t, result, "nil pointer should export as nil")
 }
 
+func TestDefaultExportArgNilStringerPointer(t *testing.T) {
+	// *time.Time implements fmt.Stringer through its value method
+	var p *time.Time
+	result := psql.DefaultExportArg(p)
+	assert.Nil(t, result, "nil *time.Time should export as nil")
+}
+
 func TestDefaultExportArgNil(t *testing.T) {
 	result := psql.DefaultExportArg(nil)
 	assert.Nil(t, result, "untyped nil should export as nil")
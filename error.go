@@ -133,6 +133,14 @@ var (
 	ErrNotReady           = errors.New("database is not ready (no connection is available)")
 	ErrNotNillable        = errors.New("field is nil but cannot be nil")
 	ErrTxAlreadyProcessed = errors.New("transaction has already been committed or rollbacked")
+	ErrTxIncompatible     = errors.New("transaction options are incompatible with the outer transaction")
+	ErrFutureTx           = errors.New("future is resolved outside of the transaction it was created in")
 	ErrDeleteBadAssert    = errors.New("delete operation failed assertion")
 	ErrBreakLoop          = errors.New("exiting loop (not an actual error, used to break out of loop callbacks)")
+	ErrStaleObject        = errors.New("object is stale (version mismatch)")
+	ErrShardKeyRequired   = errors.New("operation on a sharded table requires a shard key")
+	ErrShardMismatch      = errors.New("operation targets another shard than the transaction")
+	ErrTenantRequired     = errors.New("operation on a tenant table requires a tenant")
+	ErrTenantMismatch     = errors.New("object belongs to another tenant")
+	ErrLockTimeout        = errors.New("timed out waiting for lock")
 )
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"time"
 )
 
 // FetchOptions controls the behavior of Fetch, Get, FetchOne, and related operations.
@@ -22,6 +23,7 @@ type FetchOptions struct {
 	Scopes      []Scope         // reusable query modifiers
 	WithDeleted bool            // include soft-deleted records
 	HardDelete  bool            // force hard delete even with soft delete
+	CacheTTL    time.Duration   // cache results for this duration if >0, see [Cached]
 }
 
 // Sort returns a [FetchOptions] that orders results by the given fields.
@@ -91,6 +93,9 @@ func resolveFetchOpts(opts []*FetchOptions) *FetchOptions {
 		if opt.HardDelete {
 			res.HardDelete = true
 		}
+		if opt.CacheTTL > 0 {
+			res.CacheTTL = opt.CacheTTL
+		}
 	}
 	return res
 }
@@ -124,6 +129,39 @@ func Iter[T any](ctx context.Context, where any, opts ...*FetchOptions) (func(fu
 }
 
 func (t *TableMeta[T]) Get(ctx context.Context, where any, opts ...*FetchOptions) (*T, error) {
+	if t == nil {
+		return nil, ErrNotReady
+	}
+	op := &Operation{Type: OpFetch, Where: where, Options: resolveFetchOpts(opts), single: true}
+	err := t.runOp(ctx, op, func(ctx context.Context, op *Operation) error {
+		if obj := t.identityGet(ctx, op.Where, op.Options); obj != nil {
+			op.Objects = append(op.Objects, obj)
+			return nil
+		}
+		res, err := t.get(ctx, op.Where, op.Options)
+		if err != nil {
+			return err
+		}
+		if identityPlain(op.Options) {
+			res = t.identityAdd(ctx, res, false)
+		}
+		op.Objects = append(op.Objects, res)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res, err := opTargets[T](op)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, os.ErrNotExist
+	}
+	return res[0], nil
+}
+
+func (t *TableMeta[T]) get(ctx context.Context, where any, opts ...*FetchOptions) (*T, error) {
 	if t == nil {
 		return nil, ErrNotReady
 	}
@@ -136,6 +174,9 @@ func (t *TableMeta[T]) Get(ctx context.Context, where any, opts ...*FetchOptions
 		req = req.Where(where)
 	}
 	t.applySoftDelete(req, opt)
+	if err := t.applyTenant(ctx, req); err != nil {
+		return nil, err
+	}
 	req = req.Limit(1)
 
 	if opt.Lock {
@@ -145,23 +186,36 @@ func (t *TableMeta[T]) Get(ctx context.Context, where any, opts ...*FetchOptions
 	}
 	req = req.Apply(opt.Scopes...)
 
-	// run query
-	rows, err := req.RunQuery(ctx)
-	if err != nil {
-		slog.ErrorContext(ctx, err.Error()+"\n"+debugStack(), "event", "psql:get:run_fail", "psql.table", t.table)
-		return nil, err
-	}
-	defer rows.Close()
+	var result *T
+	if opt.useCache(ctx) {
+		list, err := t.fetchCached(ctx, req, opt.CacheTTL)
+		if err != nil {
+			slog.ErrorContext(ctx, err.Error()+"\n"+debugStack(), "event", "psql:get:run_fail", "psql.table", t.table)
+			return nil, err
+		}
+		if len(list) == 0 {
+			return nil, os.ErrNotExist
+		}
+		result = list[0]
+	} else {
+		// run query
+		rows, err := req.RunQuery(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, err.Error()+"\n"+debugStack(), "event", "psql:get:run_fail", "psql.table", t.table)
+			return nil, err
+		}
+		defer rows.Close()
 
-	if !rows.Next() {
-		// no result
-		return nil, os.ErrNotExist
-	}
-	result, err := t.spawn(ctx, rows)
-	// Close rows before preloading to free the connection
-	rows.Close()
-	if err != nil {
-		return nil, err
+		if !rows.Next() {
+			// no result
+			return nil, os.ErrNotExist
+		}
+		result, err = t.spawn(ctx, rows)
+		// Close rows before preloading to free the connection
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if len(opt.Preload) > 0 {
@@ -174,6 +228,20 @@ func (t *TableMeta[T]) Get(ctx context.Context, where any, opts ...*FetchOptions
 }
 
 func (t *TableMeta[T]) FetchOne(ctx context.Context, target *T, where any, opts ...*FetchOptions) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	op := &Operation{Type: OpFetch, Where: where, Options: resolveFetchOpts(opts), single: true}
+	return t.runOp(ctx, op, func(ctx context.Context, op *Operation) error {
+		if err := t.fetchOne(ctx, target, op.Where, op.Options); err != nil {
+			return err
+		}
+		op.Objects = []any{target}
+		return nil
+	})
+}
+
+func (t *TableMeta[T]) fetchOne(ctx context.Context, target *T, where any, opts ...*FetchOptions) error {
 	if t == nil {
 		return ErrNotReady
 	}
@@ -192,6 +260,9 @@ func (t *TableMeta[T]) FetchOne(ctx context.Context, target *T, where any, opts
 		req = req.Where(where)
 	}
 	t.applySoftDelete(req, opt)
+	if err := t.applyTenant(ctx, req); err != nil {
+		return err
+	}
 	if len(opt.Sort) > 0 {
 		req = req.OrderBy(opt.Sort...)
 	}
@@ -234,6 +305,22 @@ func (t *TableMeta[T]) FetchOne(ctx context.Context, target *T, where any, opts
 }
 
 func (t *TableMeta[T]) Fetch(ctx context.Context, where any, opts ...*FetchOptions) ([]*T, error) {
+	if t == nil {
+		return nil, ErrNotReady
+	}
+	op := &Operation{Type: OpFetch, Where: where, Options: resolveFetchOpts(opts)}
+	err := t.runOp(ctx, op, func(ctx context.Context, op *Operation) error {
+		res, err := t.fetch(ctx, op.Where, op.Options)
+		op.Objects = append(op.Objects, objectsOf(res)...)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return opTargets[T](op)
+}
+
+func (t *TableMeta[T]) fetch(ctx context.Context, where any, opts ...*FetchOptions) ([]*T, error) {
 	if t == nil {
 		return nil, ErrNotReady
 	}
@@ -247,6 +334,9 @@ func (t *TableMeta[T]) Fetch(ctx context.Context, where any, opts ...*FetchOptio
 		req = req.Where(where)
 	}
 	t.applySoftDelete(req, opt)
+	if err := t.applyTenant(ctx, req); err != nil {
+		return nil, err
+	}
 
 	if len(opt.Sort) > 0 {
 		req = req.OrderBy(opt.Sort...)
@@ -267,22 +357,30 @@ func (t *TableMeta[T]) Fetch(ctx context.Context, where any, opts ...*FetchOptio
 	}
 	req = req.Apply(opt.Scopes...)
 
-	// run query
-	rows, err := req.RunQuery(ctx)
-	if err != nil {
-		slog.ErrorContext(ctx, err.Error()+"\n"+debugStack(), "event", "psql:fetch:run_fail", "psql.table", t.table)
-		return nil, err
-	}
-	defer rows.Close()
-
 	var final []*T
-
-	for rows.Next() {
-		val, err := t.spawn(ctx, rows)
+	if opt.useCache(ctx) {
+		var err error
+		final, err = t.fetchCached(ctx, req, opt.CacheTTL)
+		if err != nil {
+			slog.ErrorContext(ctx, err.Error()+"\n"+debugStack(), "event", "psql:fetch:run_fail", "psql.table", t.table)
+			return nil, err
+		}
+	} else {
+		// run query
+		rows, err := req.RunQuery(ctx)
 		if err != nil {
+			slog.ErrorContext(ctx, err.Error()+"\n"+debugStack(), "event", "psql:fetch:run_fail", "psql.table", t.table)
 			return nil, err
 		}
-		final = append(final, val)
+		defer rows.Close()
+
+		for rows.Next() {
+			val, err := t.spawn(ctx, rows)
+			if err != nil {
+				return nil, err
+			}
+			final = append(final, val)
+		}
 	}
 
 	if len(opt.Preload) > 0 && len(final) > 0 {
@@ -295,6 +393,20 @@ func (t *TableMeta[T]) Fetch(ctx context.Context, where any, opts ...*FetchOptio
 }
 
 func (t *TableMeta[T]) Iter(ctx context.Context, where any, opts ...*FetchOptions) (func(func(v *T) bool), error) {
+	if t == nil {
+		return nil, ErrNotReady
+	}
+	var res func(func(v *T) bool)
+	op := &Operation{Type: OpFetch, Where: where, Options: resolveFetchOpts(opts), noFanOut: true}
+	err := t.runOp(ctx, op, func(ctx context.Context, op *Operation) error {
+		var err error
+		res, err = t.iter(ctx, op.Where, op.Options)
+		return err
+	})
+	return res, err
+}
+
+func (t *TableMeta[T]) iter(ctx context.Context, where any, opts ...*FetchOptions) (func(func(v *T) bool), error) {
 	if t == nil {
 		return nil, ErrNotReady
 	}
@@ -308,6 +420,9 @@ func (t *TableMeta[T]) Iter(ctx context.Context, where any, opts ...*FetchOption
 		req = req.Where(where)
 	}
 	t.applySoftDelete(req, opt)
+	if err := t.applyTenant(ctx, req); err != nil {
+		return nil, err
+	}
 
 	if len(opt.Sort) > 0 {
 		req = req.OrderBy(opt.Sort...)
@@ -2,7 +2,6 @@ package psql
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log/slog"
 )
@@ -15,6 +14,39 @@ func FetchMapped[T any](ctx context.Context, where any, key string, opts ...*Fet
 }
 
 func (t *TableMeta[T]) FetchMapped(ctx context.Context, where any, key string, opts ...*FetchOptions) (map[string]*T, error) {
+	if t == nil {
+		return nil, ErrNotReady
+	}
+	op := &Operation{Type: OpFetch, Where: where, Options: resolveFetchOpts(opts)}
+	err := t.runOp(ctx, op, func(ctx context.Context, op *Operation) error {
+		m, err := t.fetchMapped(ctx, op.Where, key, op.Options)
+		for _, v := range m {
+			op.Objects = append(op.Objects, v)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// built from op.Objects, as merged (and sorted and limited) over shards
+	objs, err := opTargets[T](op)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]*T, len(objs))
+	for _, v := range objs {
+		res[t.mapKey(v, key)] = v
+	}
+	return res, nil
+}
+
+// mapKey returns the key of v in the results of FetchMapped and FetchGrouped.
+func (t *TableMeta[T]) mapKey(v *T, key string) string {
+	// TODO avoid using fmt.Sprintf to convert value back to string
+	return fmt.Sprintf("%v", t.rowstate(v).val[key])
+}
+
+func (t *TableMeta[T]) fetchMapped(ctx context.Context, where any, key string, opts ...*FetchOptions) (map[string]*T, error) {
 	if t == nil {
 		return nil, ErrNotReady
 	}
@@ -28,6 +60,9 @@ func (t *TableMeta[T]) FetchMapped(ctx context.Context, where any, key string, o
 		req = req.Where(where)
 	}
 	t.applySoftDelete(req, opt)
+	if err := t.applyTenant(ctx, req); err != nil {
+		return nil, err
+	}
 
 	if len(opt.Sort) > 0 {
 		req = req.OrderBy(opt.Sort...)
@@ -61,12 +96,7 @@ func (t *TableMeta[T]) FetchMapped(ctx context.Context, where any, key string, o
 		if err != nil {
 			return nil, err
 		}
-		st := t.rowstate(val)
-		if st == nil {
-			return nil, errors.New("object is not appropriate for FetchMapped")
-		}
-		// TODO avoid using fmt.Sprintf to convert value back to string
-		final[fmt.Sprintf("%v", st.val[key])] = val
+		final[t.mapKey(val, key)] = val
 	}
 
 	return final, nil
@@ -79,6 +109,36 @@ func FetchGrouped[T any](ctx context.Context, where map[string]any, key string,
 }
 
 func (t *TableMeta[T]) FetchGrouped(ctx context.Context, where any, key string, opts ...*FetchOptions) (map[string][]*T, error) {
+	if t == nil {
+		return nil, ErrNotReady
+	}
+	op := &Operation{Type: OpFetch, Where: where, Options: resolveFetchOpts(opts)}
+	err := t.runOp(ctx, op, func(ctx context.Context, op *Operation) error {
+		m, err := t.fetchGrouped(ctx, op.Where, key, op.Options)
+		for _, list := range m {
+			for _, v := range list {
+				op.Objects = append(op.Objects, v)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	// built from op.Objects, as merged (and sorted and limited) over shards
+	objs, err := opTargets[T](op)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string][]*T)
+	for _, v := range objs {
+		k := t.mapKey(v, key)
+		res[k] = append(res[k], v)
+	}
+	return res, nil
+}
+
+func (t *TableMeta[T]) fetchGrouped(ctx context.Context, where any, key string, opts ...*FetchOptions) (map[string][]*T, error) {
 	if t == nil {
 		return nil, ErrNotReady
 	}
@@ -92,6 +152,9 @@ func (t *TableMeta[T]) FetchGrouped(ctx context.Context, where any, key string,
 		req = req.Where(where)
 	}
 	t.applySoftDelete(req, opt)
+	if err := t.applyTenant(ctx, req); err != nil {
+		return nil, err
+	}
 
 	if len(opt.Sort) > 0 {
 		req = req.OrderBy(opt.Sort...)
@@ -125,12 +188,7 @@ func (t *TableMeta[T]) FetchGrouped(ctx context.Context, where any, key string,
 		if err != nil {
 			return nil, err
 		}
-		st := t.rowstate(val)
-		if st == nil {
-			return nil, errors.New("object is not appropriate for FetchGrouped")
-		}
-		// TODO avoid using fmt.Sprintf to convert value back to string
-		k := fmt.Sprintf("%v", st.val[key])
+		k := t.mapKey(val, key)
 		final[k] = append(final[k], val)
 	}
 
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"log/slog"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // StructField holds metadata for a single table field/column, including its
@@ -68,6 +70,27 @@ func (f *StructField) resolveAttrs(be *Backend, attrs map[string]string) map[str
 	return attrs
 }
 
+// precision returns the time resolution of this field for the given backend,
+// derived from the fractional seconds size of its resolved type (for example
+// TIMESTAMP(6) stores microseconds). Defaults to one second.
+func (f *StructField) precision(be *Backend) time.Duration {
+	size, err := strconv.Atoi(f.GetAttrs(be)["size"])
+	if err != nil || size <= 0 {
+		return time.Second
+	}
+	p := time.Second
+	for ; size > 0 && p > time.Nanosecond; size-- {
+		p /= 10
+	}
+	return p
+}
+
+// now returns the current UTC time truncated to the precision of this field,
+// so the value kept in memory matches what the database will store.
+func (f *StructField) now(be *Backend) time.Time {
+	return time.Now().UTC().Truncate(f.precision(be))
+}
+
 // SqlType returns the SQL type string for this field, dispatching to the
 // engine's TypeMapper if available.
 func (f *StructField) SqlType(be *Backend) string {
@@ -0,0 +1,359 @@
+package psql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"time"
+)
+
+type ctxActorKey struct{}
+
+// WithActor returns a context whose changes to history tables are recorded as
+// made by actor, typically a user or service identifier.
+//
+// Tables opt in to history with the history table attribute:
+//
+//	type Order struct {
+//	    psql.Name `sql:"orders,history"`
+//	    ID        uint64 `sql:",key=PRIMARY"`
+//	    Total     int64
+//	}
+//
+// Every typed write on such a table adds a row to orders_history, created by
+// the schema checker, holding the operation (insert, insert_ignore, replace,
+// upsert, update, delete or restore), the time, the actor, the key of the
+// changed row as JSON, and its old and new values as JSON objects. Updates
+// only record the changed columns, using the state of objects returned by a
+// fetch; inserts only record new values and hard deletes old values. Upserts
+// and replaces read the conflicting row first, and record it whole as old
+// values.
+//
+// The history row is written in the transaction of the change. Outside of a
+// transaction, each write runs in its own transaction. [UpdateWhere],
+// [Delete] and [Restore] read the matching rows before and after the change,
+// so that each row gets its history entry.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, ctxActorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set with [WithActor], if any.
+func ActorFromContext(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(ctxActorKey{}).(string)
+	return actor, ok
+}
+
+// historyRow is a row of a history table. Its name is derived from the
+// tracked table, see historyView.
+type historyRow struct {
+	HistoryID string    `sql:",key=PRIMARY,type=VARCHAR,size=32"`
+	Operation string    `sql:",type=VARCHAR,size=16"`
+	RowKey    string    `sql:",type=TEXT"` // keys of any length fit, but cannot be indexed on every engine
+	Actor     *string   `sql:",type=VARCHAR,size=255"`
+	ChangedAt time.Time `sql:",key=changed"`
+	OldValues *string   `sql:",type=TEXT"`
+	NewValues *string   `sql:",type=TEXT"`
+}
+
+// historyOf is used to track the schema check of the history table of T
+// separately from T.
+type historyOf[T any] struct{}
+
+// historyView describes the history table of t to the schema checker.
+type historyView[T any] struct {
+	t *TableMeta[T]
+}
+
+var _ TableView = historyView[struct{}]{}
+
+func (v historyView[T]) TableName() string {
+	return v.t.table + "_history"
+}
+
+func (v historyView[T]) FormattedName(be *Backend) string {
+	return v.t.FormattedName(be) + "_history"
+}
+
+func (v historyView[T]) AllFields() []*StructField {
+	return Table[historyRow]().fields
+}
+
+// AllKeys returns the keys of the history table, with index names prefixed by
+// the table name since some engines require them to be unique per schema.
+func (v historyView[T]) AllKeys() []*StructKey {
+	keys := Table[historyRow]().keys
+	res := make([]*StructKey, len(keys))
+	for n, k := range keys {
+		k2 := *k
+		if k.Typ != KeyPrimary {
+			k2.Name = v.TableName() + "_" + k.Name
+			k2.Key = v.TableName() + "_" + k.Key
+		}
+		res[n] = &k2
+	}
+	return res
+}
+
+func (v historyView[T]) MainKey() *StructKey {
+	return Table[historyRow]().mainKey
+}
+
+func (v historyView[T]) FieldByColumn(col string) *StructField {
+	return Table[historyRow]().fldcol[col]
+}
+
+func (v historyView[T]) FieldStr() string {
+	return Table[historyRow]().fldStr
+}
+
+func (v historyView[T]) TableAttrs() map[string]string {
+	return map[string]string{}
+}
+
+func (v historyView[T]) HasSoftDelete() bool {
+	return false
+}
+
+// historyTx runs fn in a transaction if op writes to a history table outside
+// of one, so that changes and their history are stored together.
+func (t *TableMeta[T]) historyTx(ctx context.Context, op *Operation, fn Handler) error {
+	if !t.history || !op.Type.IsWrite() || inTx(ctx) {
+		return fn(ctx, op)
+	}
+	return Tx(ctx, func(ctx context.Context) error {
+		return fn(ctx, op)
+	})
+}
+
+// checkHistory runs CheckStructure on the history table if it hasn't been run
+// yet on this connection.
+func (t *TableMeta[T]) checkHistory(ctx context.Context) {
+	be := GetBackend(ctx)
+	if be.checkedOnce(reflect.TypeFor[historyOf[T]]()) {
+		return
+	}
+
+	if sc, ok := be.Engine().dialect().(SchemaChecker); ok {
+		view := historyView[T]{t}
+		if err := sc.CheckStructure(ctx, be, view); err != nil {
+			slog.ErrorContext(ctx, "psql: failed to check table "+view.TableName()+": "+err.Error(), "event", "psql:table:check_error", "psql.table", view.TableName())
+		}
+	}
+}
+
+// recordHistory writes a row in the history table for the object val.
+// oldVals and newVals map columns to values, and are stored as NULL when nil.
+func (t *TableMeta[T]) recordHistory(ctx context.Context, op string, val reflect.Value, oldVals, newVals map[string]any) error {
+	t.checkHistory(ctx)
+
+	be := GetBackend(ctx)
+	engine := be.Engine()
+	ht := Table[historyRow]()
+
+	key, err := json.Marshal(t.keyValues(val))
+	if err != nil {
+		return err
+	}
+	row := &historyRow{
+		HistoryID: rand.Text(),
+		Operation: op,
+		RowKey:    string(key),
+		ChangedAt: time.Now().UTC(),
+	}
+	if actor, ok := ActorFromContext(ctx); ok {
+		row.Actor = &actor
+	}
+	if row.OldValues, err = historyJSON(oldVals); err != nil {
+		return err
+	}
+	if row.NewValues, err = historyJSON(newVals); err != nil {
+		return err
+	}
+
+	rowVal := reflect.ValueOf(row).Elem()
+	params := make([]any, len(ht.fields))
+	for n, f := range ht.fields {
+		fval := rowVal.Field(f.Index)
+		if fval.Kind() == reflect.Ptr && fval.IsNil() {
+			continue
+		}
+		params[n] = engine.export(fval.Interface(), f)
+	}
+
+	tableName := historyView[T]{t}.FormattedName(be)
+	req := "INSERT INTO " + QuoteName(tableName) + " (" + ht.fldStr + ") VALUES (" + engine.Placeholders(len(ht.fields), 1) + ")"
+	if _, err := ExecContext(ctx, req, params...); err != nil {
+		slog.ErrorContext(ctx, req+"\n"+err.Error()+"\n"+debugStack(), "event", "psql:history:run_fail", "psql.table", tableName)
+		return &Error{Query: req, Err: err}
+	}
+	return nil
+}
+
+func historyJSON(values map[string]any) (*string, error) {
+	if values == nil {
+		return nil, nil
+	}
+	buf, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	s := string(buf)
+	return &s, nil
+}
+
+// keyValues returns the main key columns of val.
+func (t *TableMeta[T]) keyValues(val reflect.Value) map[string]any {
+	res := make(map[string]any, len(t.mainKey.Fields))
+	for _, col := range t.mainKey.Fields {
+		res[col] = val.Field(t.fldcol[col].Index).Interface()
+	}
+	return res
+}
+
+// rowValues returns all columns of val.
+func (t *TableMeta[T]) rowValues(val reflect.Value) map[string]any {
+	res := make(map[string]any, len(t.fields))
+	for _, f := range t.fields {
+		res[f.Column] = val.Field(f.Index).Interface()
+	}
+	return res
+}
+
+// stateValues returns the values stored in st for the given columns, or nil
+// if st holds no values. JSON columns are stored encoded in the state and are
+// returned as [json.RawMessage].
+func (t *TableMeta[T]) stateValues(st *rowState, cols []string) map[string]any {
+	if st == nil || !st.init {
+		return nil
+	}
+	res := make(map[string]any, len(cols))
+	for _, col := range cols {
+		v := st.val[col]
+		if s, ok := v.(string); ok && t.fldcol[col].Attrs["format"] == "json" {
+			v = json.RawMessage(s)
+		}
+		res[col] = v
+	}
+	return res
+}
+
+// storedValues returns all columns of val as last read from or written to the
+// database according to st, or the current values of val if st holds none.
+func (t *TableMeta[T]) storedValues(st *rowState, val reflect.Value) map[string]any {
+	if st == nil || !st.init {
+		return t.rowValues(val)
+	}
+	cols := make([]string, len(t.fields))
+	for n, f := range t.fields {
+		cols[n] = f.Column
+	}
+	return t.stateValues(st, cols)
+}
+
+// historyBefore returns the rows matched by a set-based write, so that
+// historyAfter can record their changes. withDeleted must match whether the
+// write applies to soft deleted rows. It returns nil if the table has no
+// history.
+func (t *TableMeta[T]) historyBefore(ctx context.Context, where any, opt *FetchOptions, withDeleted bool) ([]*T, error) {
+	if !t.history {
+		return nil, nil
+	}
+	o := &FetchOptions{
+		Lock:        true,
+		WithDeleted: withDeleted,
+		LimitStart:  opt.LimitStart,
+		LimitCount:  opt.LimitCount,
+		Scopes:      opt.Scopes,
+	}
+	return t.fetch(ctx, where, o)
+}
+
+// historyAfter reads the rows returned by historyBefore again and records
+// their changes. Rows that are gone are recorded with their old values only,
+// and unchanged rows are not recorded.
+func (t *TableMeta[T]) historyAfter(ctx context.Context, op string, before []*T) error {
+	if len(before) == 0 {
+		return nil
+	}
+
+	var where WhereOR
+	for _, obj := range before {
+		where = append(where, t.keyValues(reflect.ValueOf(obj).Elem()))
+	}
+	after, err := t.fetch(ctx, where, IncludeDeleted())
+	if err != nil {
+		return err
+	}
+	byKey := make(map[string]reflect.Value, len(after))
+	for _, obj := range after {
+		val := reflect.ValueOf(obj).Elem()
+		key, _ := json.Marshal(t.keyValues(val))
+		byKey[string(key)] = val
+	}
+
+	for _, obj := range before {
+		oldVal := reflect.ValueOf(obj).Elem()
+		key, _ := json.Marshal(t.keyValues(oldVal))
+		newVal, ok := byKey[string(key)]
+		if !ok {
+			if err := t.recordHistory(ctx, op, oldVal, t.rowValues(oldVal), nil); err != nil {
+				return err
+			}
+			continue
+		}
+		oldVals, newVals := make(map[string]any), make(map[string]any)
+		for _, f := range t.fields {
+			o, n := oldVal.Field(f.Index).Interface(), newVal.Field(f.Index).Interface()
+			if !reflect.DeepEqual(o, n) {
+				oldVals[f.Column] = o
+				newVals[f.Column] = n
+			}
+		}
+		if len(newVals) == 0 {
+			continue
+		}
+		if err := t.recordHistory(ctx, op, oldVal, oldVals, newVals); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// historyConflicts returns the stored rows matching val on any of the given
+// column sets, read before an upsert or replace of val so that their old
+// values can be recorded. It returns nil if the table has no history.
+func (t *TableMeta[T]) historyConflicts(ctx context.Context, val reflect.Value, sets [][]string) ([]*T, error) {
+	if !t.history || len(sets) == 0 {
+		return nil, nil
+	}
+	var where WhereOR
+	for _, cols := range sets {
+		m := make(map[string]any, len(cols))
+		for _, col := range cols {
+			m[col] = val.Field(t.fldcol[col].Index).Interface()
+		}
+		where = append(where, m)
+	}
+	return t.historyBefore(ctx, where, &FetchOptions{}, true)
+}
+
+// historyReplaced records the replace of val, given the rows it conflicted
+// with: the row with the key of val holds its old values, and rows with
+// another key were deleted.
+func (t *TableMeta[T]) historyReplaced(ctx context.Context, val reflect.Value, before []*T) error {
+	key := t.keyValues(val)
+	var oldVals map[string]any
+	for _, obj := range before {
+		oldVal := reflect.ValueOf(obj).Elem()
+		if reflect.DeepEqual(t.keyValues(oldVal), key) {
+			oldVals = t.rowValues(oldVal)
+			continue
+		}
+		if err := t.recordHistory(ctx, "replace", oldVal, t.rowValues(oldVal), nil); err != nil {
+			return err
+		}
+	}
+	return t.recordHistory(ctx, "replace", val, oldVals, t.rowValues(val))
+}
@@ -0,0 +1,221 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type historyOrder struct {
+	psql.Name `sql:"history_orders,history"`
+	ID        uint64 `sql:",key=PRIMARY"`
+	Status    string `sql:",type=VARCHAR,size=16"`
+	Total     int64
+}
+
+// historyEntry decodes the arguments of an INSERT into a history table.
+type historyEntry struct {
+	Operation string
+	RowKey    string
+	Actor     any
+	Old, New  map[string]any
+}
+
+func historyEntries(t *testing.T, db *fakedb.DB) []historyEntry {
+	t.Helper()
+	var res []historyEntry
+	for _, q := range db.Queries() {
+		if !strings.HasPrefix(q.Query, `INSERT INTO "history_orders_history"`) {
+			continue
+		}
+		// HistoryID, Operation, RowKey, Actor, ChangedAt, OldValues, NewValues
+		require.Len(t, q.Args, 7)
+		e := historyEntry{Operation: q.Args[1].(string), RowKey: q.Args[2].(string), Actor: q.Args[3]}
+		if s, ok := q.Args[5].(string); ok {
+			require.NoError(t, json.Unmarshal([]byte(s), &e.Old))
+		}
+		if s, ok := q.Args[6].(string); ok {
+			require.NoError(t, json.Unmarshal([]byte(s), &e.New))
+		}
+		res = append(res, e)
+	}
+	return res
+}
+
+func TestHistoryInsert(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	ctx = psql.WithActor(ctx, "alice")
+
+	require.NoError(t, psql.Insert(ctx, &historyOrder{ID: 1, Status: "new", Total: 10}))
+
+	queries := db.Queries()
+	require.Len(t, queries, 4)
+	assert.Equal(t, "BEGIN", queries[0].Query)
+	assert.Equal(t, "COMMIT", queries[3].Query)
+
+	entries := historyEntries(t, db)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "insert", entries[0].Operation)
+	assert.Equal(t, `{"ID":1}`, entries[0].RowKey)
+	assert.Equal(t, "alice", entries[0].Actor)
+	assert.Nil(t, entries[0].Old)
+	assert.Equal(t, map[string]any{"ID": 1.0, "Status": "new", "Total": 10.0}, entries[0].New)
+}
+
+func TestHistoryUpdateDiff(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{Cols: []string{"ID", "Status", "Total"}, Data: [][]driver.Value{{int64(1), "new", int64(10)}}}, nil
+	}
+
+	o, err := psql.Get[historyOrder](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	o.Total = 12
+	require.NoError(t, psql.Update(ctx, o))
+
+	entries := historyEntries(t, db)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "update", entries[0].Operation)
+	assert.Nil(t, entries[0].Actor)
+	assert.Equal(t, map[string]any{"Total": 10.0}, entries[0].Old)
+	assert.Equal(t, map[string]any{"Total": 12.0}, entries[0].New)
+}
+
+func TestHistoryInTransaction(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	err := psql.Tx(ctx, func(ctx context.Context) error {
+		return psql.DeleteObj(ctx, &historyOrder{ID: 3, Status: "new"})
+	})
+	require.NoError(t, err)
+
+	var begins int
+	for _, q := range db.Queries() {
+		if q.Query == "BEGIN" {
+			begins++
+		}
+	}
+	assert.Equal(t, 1, begins, "no nested transaction")
+
+	entries := historyEntries(t, db)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "delete", entries[0].Operation)
+	assert.Equal(t, "new", entries[0].Old["Status"])
+	assert.Nil(t, entries[0].New)
+}
+
+func TestHistoryDeleteWhere(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	deleted := false
+	db.OnExec = func(q string, args []driver.Value) (driver.Result, error) {
+		if strings.HasPrefix(q, "DELETE") {
+			deleted = true
+		}
+		return driver.RowsAffected(2), nil
+	}
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		rows := &fakedb.Rows{Cols: []string{"ID", "Status", "Total"}}
+		if !deleted {
+			rows.Data = [][]driver.Value{{int64(1), "new", int64(10)}, {int64(2), "new", int64(20)}}
+		}
+		return rows, nil
+	}
+
+	_, err := psql.Delete[historyOrder](ctx, map[string]any{"Status": "new"})
+	require.NoError(t, err)
+
+	entries := historyEntries(t, db)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "delete", entries[0].Operation)
+	assert.Equal(t, `{"ID":1}`, entries[0].RowKey)
+	assert.Equal(t, `{"ID":2}`, entries[1].RowKey)
+	assert.Equal(t, 20.0, entries[1].Old["Total"])
+}
+
+func TestHistoryUpsertReplace(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{Cols: []string{"ID", "Status", "Total"}, Data: [][]driver.Value{{int64(1), "new", int64(10)}}}, nil
+	}
+
+	require.NoError(t, psql.Upsert(ctx, &historyOrder{ID: 1, Status: "paid", Total: 10}))
+	sel, ok := db.Find("SELECT")
+	require.True(t, ok)
+	assert.Contains(t, sel.Query, `"ID"=?`, "the conflicting row is read first")
+
+	require.NoError(t, psql.Replace(ctx, &historyOrder{ID: 1, Status: "shipped", Total: 10}))
+
+	entries := historyEntries(t, db)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "upsert", entries[0].Operation)
+	assert.Equal(t, map[string]any{"ID": 1.0, "Status": "new", "Total": 10.0}, entries[0].Old)
+	assert.Equal(t, "paid", entries[0].New["Status"])
+	assert.Equal(t, "replace", entries[1].Operation)
+	assert.Equal(t, "new", entries[1].Old["Status"])
+	assert.Equal(t, "shipped", entries[1].New["Status"])
+}
+
+func TestHistoryUpdateWhereSkipsUnchanged(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	updated := false
+	db.OnExec = func(q string, args []driver.Value) (driver.Result, error) {
+		if strings.HasPrefix(q, `UPDATE "history_orders"`) {
+			updated = true
+		}
+		return driver.RowsAffected(1), nil
+	}
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		status := "new"
+		if updated {
+			status = "paid"
+		}
+		return &fakedb.Rows{Cols: []string{"ID", "Status", "Total"}, Data: [][]driver.Value{{int64(1), status, int64(10)}}}, nil
+	}
+
+	_, err := psql.UpdateWhere[historyOrder](ctx, map[string]any{"ID": 1}, map[string]any{"Status": "paid"})
+	require.NoError(t, err)
+
+	entries := historyEntries(t, db)
+	require.Len(t, entries, 1)
+	assert.Equal(t, map[string]any{"Status": "new"}, entries[0].Old)
+	assert.Equal(t, map[string]any{"Status": "paid"}, entries[0].New)
+}
+
+// historySchemaDialect records the tables passed to the schema checker.
+type historySchemaDialect struct {
+	testSqliteDialect
+	checked []psql.TableView
+}
+
+func (d *historySchemaDialect) CheckStructure(ctx context.Context, be *psql.Backend, tv psql.TableView) error {
+	d.checked = append(d.checked, tv)
+	return nil
+}
+
+func TestHistorySchemaCheck(t *testing.T) {
+	engine := psql.Engine(102)
+	d := &historySchemaDialect{}
+	psql.RegisterDialect(engine, d)
+
+	_, be, ctx := fakedb.NewBackend(t, engine)
+	require.NoError(t, psql.Insert(ctx, &historyOrder{ID: 1}))
+	require.NoError(t, psql.Insert(ctx, &historyOrder{ID: 2}))
+	require.Len(t, d.checked, 2)
+	assert.Equal(t, "history_orders", d.checked[0].FormattedName(be))
+
+	hist := d.checked[1]
+	assert.Equal(t, "history_orders_history", hist.FormattedName(be))
+	assert.NotNil(t, hist.FieldByColumn("OldValues"))
+	for _, k := range hist.AllKeys() {
+		if k.Typ != psql.KeyPrimary {
+			assert.Equal(t, "history_orders_history_changed", k.Key)
+		}
+	}
+}
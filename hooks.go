@@ -36,3 +36,13 @@ type AfterSaveHook interface {
 type AfterScanHook interface {
 	AfterScan(ctx context.Context) error
 }
+
+// BeforeDeleteHook is called before a DELETE (or soft delete) operation on an object.
+type BeforeDeleteHook interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// AfterDeleteHook is called after a successful DELETE (or soft delete) operation on an object.
+type AfterDeleteHook interface {
+	AfterDelete(ctx context.Context) error
+}
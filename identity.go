@@ -0,0 +1,287 @@
+package psql
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+type ctxIdentityKey struct{}
+
+// identityMap holds the objects loaded through a context created by
+// [WithIdentityMap], by table type, backend and main key.
+type identityMap struct {
+	lk   sync.Mutex
+	objs map[identityTable]map[string]any
+}
+
+// identityTable identifies the objects of a table on a backend, so that rows
+// of different shards with the same key are kept apart.
+type identityTable struct {
+	typ reflect.Type
+	be  *Backend
+}
+
+// WithIdentityMap returns a context caching the objects loaded through it by
+// table and main key, typically for the duration of an HTTP request:
+//
+//	ctx = psql.WithIdentityMap(ctx)
+//	a, _ := psql.Get[User](ctx, map[string]any{"ID": 1}) // query
+//	b, _ := psql.Get[User](ctx, map[string]any{"ID": 1}) // a == b, no query
+//
+// [Get] with a where clause made only of the main key columns returns the
+// cached object if there is one, still going through middlewares and
+// tracing. Objects loaded by Get and resolved by [Future.Resolve] are cached,
+// and both return the cached object when they load a row already in the map,
+// so they share a single object per row. Other reads, such as [Fetch] and
+// [FetchOne], neither use nor fill the map.
+//
+// Writes through the context keep the map up to date: [Update] caches the
+// updated object, [DeleteObj], [Replace] and [Upsert] drop the objects they
+// write, and [UpdateWhere], [Delete] and [Restore] drop all the objects of the
+// table. Changes made by other means (other contexts, raw queries) are not
+// seen, and objects stay cached when a transaction is rolled back.
+//
+// Get calls with options other than sorting or a limit bypass the map.
+func WithIdentityMap(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxIdentityKey{}, &identityMap{objs: make(map[identityTable]map[string]any)})
+}
+
+func identityFromContext(ctx context.Context) *identityMap {
+	m, _ := ctx.Value(ctxIdentityKey{}).(*identityMap)
+	return m
+}
+
+// identityPlain returns true if objects loaded with opt can be shared through
+// the identity map.
+func identityPlain(opt *FetchOptions) bool {
+	return opt == nil || (!opt.Lock && len(opt.Preload) == 0 && len(opt.Scopes) == 0 && !opt.WithDeleted)
+}
+
+// identityKey returns the identity map key for the main key values in kv, by
+// field name or column. It returns false if kv holds anything else than one
+// value per main key column, convertible to the field type.
+func (t *TableMeta[T]) identityKey(kv map[string]any) (string, bool) {
+	if t.mainKey == nil || len(kv) != len(t.mainKey.Fields) {
+		return "", false
+	}
+	vals := make([]any, len(t.mainKey.Fields))
+	found := 0
+	for name, v := range kv {
+		f := findFieldByNameOrCol(t.fldcol, name)
+		if f == nil || v == nil {
+			return "", false
+		}
+		pos := -1
+		for n, col := range t.mainKey.Fields {
+			if col == f.Column {
+				pos = n
+			}
+		}
+		if pos == -1 || vals[pos] != nil {
+			return "", false
+		}
+		rv, ok := identityConvert(reflect.ValueOf(v), t.typ.Field(f.Index).Type)
+		if !ok {
+			return "", false
+		}
+		vals[pos] = rv.Interface()
+		found++
+	}
+	key, err := json.Marshal(vals)
+	if err != nil || found != len(vals) {
+		return "", false
+	}
+	return string(key), true
+}
+
+// identityConvert converts a where value to the type of a key field, allowing
+// conversions between numbers, from numeric strings (as passed to [Lazy]) and
+// between types of the same kind only, so that expressions or lists never
+// match.
+func identityConvert(v reflect.Value, typ reflect.Type) (reflect.Value, bool) {
+	if v.Type() == typ {
+		return v, true
+	}
+	if v.Kind() == reflect.String && isNumberKind(typ.Kind()) {
+		res := reflect.New(typ).Elem()
+		var err error
+		switch {
+		case res.CanInt():
+			var n int64
+			n, err = strconv.ParseInt(v.String(), 10, typ.Bits())
+			res.SetInt(n)
+		case res.CanUint():
+			var n uint64
+			n, err = strconv.ParseUint(v.String(), 10, typ.Bits())
+			res.SetUint(n)
+		default:
+			var n float64
+			n, err = strconv.ParseFloat(v.String(), typ.Bits())
+			res.SetFloat(n)
+		}
+		return res, err == nil
+	}
+	if !v.CanConvert(typ) {
+		return v, false
+	}
+	if v.Kind() != typ.Kind() && !(isNumberKind(v.Kind()) && isNumberKind(typ.Kind())) {
+		return v, false
+	}
+	return v.Convert(typ), true
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
+
+// identityTable returns the identity map table of the rows of t on the
+// backend of ctx. With a [ShardedBackend], the shard is found from shardKey,
+// returning the shard key value if known, or from the context.
+func (t *TableMeta[T]) identityTable(ctx context.Context, shardKey func() (any, bool)) (identityTable, bool) {
+	sb := shardedFromContext(ctx)
+	if sb == nil {
+		return identityTable{t.typ, GetBackend(ctx)}, true
+	}
+	var be *Backend
+	var err error
+	if t.shardKey == nil {
+		be, err = sb.contextShard(ctx)
+	} else {
+		v, ok := shardKey()
+		if !ok {
+			v = ctx.Value(ctxShardKey{})
+			if v == nil {
+				return identityTable{}, false
+			}
+		}
+		be, err = sb.Shard(v)
+	}
+	return identityTable{t.typ, be}, err == nil
+}
+
+// objShardKey returns a function returning the shard key value of obj.
+func (t *TableMeta[T]) objShardKey(obj *T) func() (any, bool) {
+	return func() (any, bool) {
+		return reflect.ValueOf(obj).Elem().Field(t.shardKey.Index).Interface(), true
+	}
+}
+
+// identityGet returns the object cached for where in the identity map of ctx.
+func (t *TableMeta[T]) identityGet(ctx context.Context, where any, opt *FetchOptions) *T {
+	m := identityFromContext(ctx)
+	if m == nil || !identityPlain(opt) {
+		return nil
+	}
+	kv, ok := where.(map[string]any)
+	if !ok {
+		return nil
+	}
+	key, ok := t.identityKey(kv)
+	if !ok {
+		return nil
+	}
+	tbl, ok := t.identityTable(ctx, func() (any, bool) { return t.whereShardKey(where) })
+	if !ok {
+		return nil
+	}
+
+	m.lk.Lock()
+	obj, ok := m.objs[tbl][key].(*T)
+	m.lk.Unlock()
+	if !ok {
+		return nil
+	}
+	if t.tenant != nil {
+		// never share objects across tenants
+		tv, err := t.tenantValue(ctx)
+		if err != nil || !reflect.DeepEqual(tv.Interface(), reflect.ValueOf(obj).Elem().Field(t.tenant.Index).Interface()) {
+			return nil
+		}
+	}
+	return obj
+}
+
+// identityAdd caches obj in the identity map of ctx, and returns the object
+// cached for the same row if there is already one. If replace is true, obj
+// replaces it instead.
+func (t *TableMeta[T]) identityAdd(ctx context.Context, obj *T, replace bool) *T {
+	m := identityFromContext(ctx)
+	if m == nil || obj == nil || t.mainKey == nil {
+		return obj
+	}
+	key, ok := t.identityKey(t.keyValues(reflect.ValueOf(obj).Elem()))
+	if !ok {
+		return obj
+	}
+	tbl, ok := t.identityTable(ctx, t.objShardKey(obj))
+	if !ok {
+		return obj
+	}
+
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	objs := m.objs[tbl]
+	if objs == nil {
+		objs = make(map[string]any)
+		m.objs[tbl] = objs
+	}
+	if cur, ok := objs[key].(*T); ok && !replace {
+		return cur
+	}
+	objs[key] = obj
+	return obj
+}
+
+// identityDrop removes the given objects from the identity map of ctx, or all
+// objects of the table if objs is nil.
+func (t *TableMeta[T]) identityDrop(ctx context.Context, objs []any) {
+	m := identityFromContext(ctx)
+	if m == nil {
+		return
+	}
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if objs == nil || t.mainKey == nil {
+		for tbl := range m.objs {
+			if tbl.typ == t.typ {
+				delete(m.objs, tbl)
+			}
+		}
+		return
+	}
+	for _, v := range objs {
+		obj, ok := v.(*T)
+		if !ok || obj == nil {
+			continue
+		}
+		key, ok := t.identityKey(t.keyValues(reflect.ValueOf(obj).Elem()))
+		if !ok {
+			continue
+		}
+		if tbl, ok := t.identityTable(ctx, t.objShardKey(obj)); ok {
+			delete(m.objs[tbl], key)
+		}
+	}
+}
+
+// identityWritten updates the identity map of ctx after op succeeded.
+func (t *TableMeta[T]) identityWritten(ctx context.Context, op *Operation) {
+	if identityFromContext(ctx) == nil {
+		return
+	}
+	switch op.Type {
+	case OpUpdate:
+		for _, v := range op.Objects {
+			if obj, ok := v.(*T); ok {
+				t.identityAdd(ctx, obj, true)
+			}
+		}
+	case OpDeleteObj, OpReplace, OpUpsert:
+		t.identityDrop(ctx, op.Objects)
+	case OpUpdateWhere, OpDelete:
+		t.identityDrop(ctx, nil)
+	}
+}
@@ -0,0 +1,158 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"strconv"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type identityUser struct {
+	psql.Name `sql:"identity_users"`
+	ID        uint64 `sql:",key=PRIMARY"`
+	Email     string `sql:",type=VARCHAR,size=128"`
+}
+
+func identityBackend(t *testing.T) (*fakedb.DB, context.Context) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		// one row per numeric argument
+		res := &fakedb.Rows{Cols: []string{"ID", "Email"}}
+		for _, a := range args {
+			if s, ok := a.(string); ok {
+				a, _ = strconv.ParseInt(s, 10, 64)
+			}
+			if id, ok := a.(int64); ok && id > 0 {
+				res.Data = append(res.Data, []driver.Value{id, "user@example.com"})
+			}
+		}
+		return res, nil
+	}
+	return db, psql.WithIdentityMap(ctx)
+}
+
+func TestIdentityMapGet(t *testing.T) {
+	db, ctx := identityBackend(t)
+
+	a, err := psql.Get[identityUser](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	b, err := psql.Get[identityUser](ctx, map[string]any{"ID": uint64(1)})
+	require.NoError(t, err)
+	assert.Same(t, a, b)
+	assert.Equal(t, 1, len(db.Queries()))
+
+	// not a pure main key where clause
+	c, err := psql.Get[identityUser](ctx, map[string]any{"ID": 1, "Email": "user@example.com"})
+	require.NoError(t, err)
+	assert.Same(t, a, c, "loaded again, the cached object is returned")
+	assert.Equal(t, 2, len(db.Queries()))
+
+	// options loading different data bypass the map
+	_, err = psql.Get[identityUser](ctx, map[string]any{"ID": 1}, psql.FetchLock)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(db.Queries()))
+
+	// other contexts are not affected
+	_, err = psql.Get[identityUser](psql.WithIdentityMap(ctx), map[string]any{"ID": 1})
+	require.NoError(t, err)
+	assert.Equal(t, 4, len(db.Queries()))
+}
+
+func TestIdentityMapWrites(t *testing.T) {
+	db, ctx := identityBackend(t)
+
+	a, err := psql.Get[identityUser](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+
+	other := &identityUser{ID: 1, Email: "new@example.com"}
+	require.NoError(t, psql.Update(ctx, other))
+	b, err := psql.Get[identityUser](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	assert.Same(t, other, b, "Update caches the written object")
+	assert.NotSame(t, a, b)
+
+	require.NoError(t, psql.DeleteObj(ctx, other))
+	n := len(db.Queries())
+	_, err = psql.Get[identityUser](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	assert.Equal(t, n+1, len(db.Queries()), "DeleteObj drops the object")
+
+	_, err = psql.Delete[identityUser](ctx, map[string]any{"Email": "x"})
+	require.NoError(t, err)
+	n = len(db.Queries())
+	_, err = psql.Get[identityUser](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	assert.Equal(t, n+1, len(db.Queries()), "Delete drops the table")
+}
+
+func TestIdentityMapFuture(t *testing.T) {
+	db, ctx := identityBackend(t)
+
+	a, err := psql.Get[identityUser](ctx, map[string]any{"ID": 2})
+	require.NoError(t, err)
+	n := len(db.Queries())
+
+	b, err := psql.Lazy[identityUser]("ID", "2").Resolve(ctx)
+	require.NoError(t, err)
+	assert.Same(t, a, b)
+	assert.Equal(t, n, len(db.Queries()))
+
+	c, err := psql.Lazy[identityUser]("ID", "3").Resolve(ctx)
+	require.NoError(t, err)
+	d, err := psql.Get[identityUser](ctx, map[string]any{"ID": 3})
+	require.NoError(t, err)
+	assert.Same(t, c, d)
+	assert.Equal(t, n+1, len(db.Queries()))
+}
+
+func TestIdentityMapMiddleware(t *testing.T) {
+	f, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+	f.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{Cols: []string{"ID", "Email"}, Data: [][]driver.Value{{int64(1), "user@example.com"}}}, nil
+	}
+	var ops int
+	be.Use(func(next psql.Handler) psql.Handler {
+		return func(ctx context.Context, op *psql.Operation) error {
+			ops++
+			return next(ctx, op)
+		}
+	})
+	ctx = psql.WithIdentityMap(ctx)
+
+	a, err := psql.Get[identityUser](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	b, err := psql.Get[identityUser](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	assert.Same(t, a, b)
+	assert.Len(t, f.Queries(), 1)
+	assert.Equal(t, 2, ops, "cached objects are returned through the middlewares")
+}
+
+func TestIdentityMapShards(t *testing.T) {
+	fakes, _, ctx := newShards(t)
+	for i, f := range fakes {
+		row := []driver.Value{"1", strconv.Itoa(10 + i), strconv.Itoa(i)}
+		f.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+			return &fakedb.Rows{Cols: []string{"ID", "CustomerID", "Total"}, Data: [][]driver.Value{row}}, nil
+		}
+	}
+	ctx = psql.WithIdentityMap(ctx)
+
+	a, err := psql.Get[shardedOrder](psql.WithShardKey(ctx, uint64(10)), map[string]any{"ID": 1})
+	require.NoError(t, err)
+	b, err := psql.Get[shardedOrder](psql.WithShardKey(ctx, uint64(11)), map[string]any{"ID": 1})
+	require.NoError(t, err)
+	assert.NotSame(t, a, b, "rows of different shards are kept apart")
+	assert.Equal(t, int64(1), b.Total)
+
+	c, err := psql.Get[shardedOrder](psql.WithShardKey(ctx, uint64(10)), map[string]any{"ID": 1})
+	require.NoError(t, err)
+	assert.Same(t, a, c)
+	assert.Len(t, fakes[0].Queries(), 1)
+	assert.Len(t, fakes[1].Queries(), 1)
+}
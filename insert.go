@@ -14,6 +14,9 @@ import (
 //
 // psql.Table(obj).Insert(ctx, obj)
 //
+// Auto timestamp fields (CreatedAt/UpdatedAt, or tagged autoCreateTime and
+// autoUpdateTime) are set to the current time if they are zero.
+//
 // All passed objects must be of the same type
 func Insert[T any](ctx context.Context, target ...*T) error {
 	if len(target) == 0 {
@@ -24,6 +27,19 @@ func Insert[T any](ctx context.Context, target ...*T) error {
 }
 
 func (t *TableMeta[T]) Insert(ctx context.Context, targets ...*T) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	return t.runOp(ctx, &Operation{Type: OpInsert, Objects: objectsOf(targets)}, func(ctx context.Context, op *Operation) error {
+		targets, err := opTargets[T](op)
+		if err != nil {
+			return err
+		}
+		return t.insert(ctx, targets...)
+	})
+}
+
+func (t *TableMeta[T]) insert(ctx context.Context, targets ...*T) error {
 	if t == nil {
 		return ErrNotReady
 	}
@@ -67,6 +83,7 @@ func (t *TableMeta[T]) Insert(ctx context.Context, targets ...*T) error {
 		}
 
 		val := reflect.ValueOf(target).Elem()
+		t.touchCreate(be, val, false)
 
 		params := make([]any, len(t.fields))
 
@@ -82,7 +99,7 @@ func (t *TableMeta[T]) Insert(ctx context.Context, targets ...*T) error {
 		}
 
 		if useReturning {
-			rows, err := stmt.QueryContext(ctx, params...)
+			rows, err := stmtQueryContext(ctx, stmt, req, params...)
 			if err != nil {
 				slog.ErrorContext(ctx, req+"\n"+err.Error()+"\n"+debugStack(), "event", "psql:insert:run_fail", "psql.table", tableName)
 				return &Error{Query: req, Err: err}
@@ -95,13 +112,19 @@ func (t *TableMeta[T]) Insert(ctx context.Context, targets ...*T) error {
 			}
 			rows.Close()
 		} else {
-			_, err := stmt.ExecContext(ctx, params...)
+			_, err := stmtExecContext(ctx, stmt, req, params...)
 			if err != nil {
 				slog.ErrorContext(ctx, req+"\n"+err.Error()+"\n"+debugStack(), "event", "psql:insert:run_fail", "psql.table", tableName)
 				return &Error{Query: req, Err: err}
 			}
 		}
 
+		if t.history {
+			if err := t.recordHistory(ctx, "insert", val, nil, t.rowValues(val)); err != nil {
+				return err
+			}
+		}
+
 		if h, ok := any(target).(AfterInsertHook); ok {
 			if err := h.AfterInsert(ctx); err != nil {
 				return err
@@ -128,6 +151,19 @@ func InsertIgnore[T any](ctx context.Context, target ...*T) error {
 }
 
 func (t *TableMeta[T]) InsertIgnore(ctx context.Context, targets ...*T) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	return t.runOp(ctx, &Operation{Type: OpInsertIgnore, Objects: objectsOf(targets)}, func(ctx context.Context, op *Operation) error {
+		targets, err := opTargets[T](op)
+		if err != nil {
+			return err
+		}
+		return t.insertIgnore(ctx, targets...)
+	})
+}
+
+func (t *TableMeta[T]) insertIgnore(ctx context.Context, targets ...*T) error {
 	if t == nil {
 		return ErrNotReady
 	}
@@ -180,6 +216,7 @@ func (t *TableMeta[T]) InsertIgnore(ctx context.Context, targets ...*T) error {
 		}
 
 		val := reflect.ValueOf(target).Elem()
+		t.touchCreate(be, val, false)
 
 		params := make([]any, len(t.fields))
 
@@ -194,14 +231,16 @@ func (t *TableMeta[T]) InsertIgnore(ctx context.Context, targets ...*T) error {
 			params[n] = engine.export(fval.Interface(), f)
 		}
 
+		var inserted bool
 		if useReturning {
-			rows, err := stmt.QueryContext(ctx, params...)
+			rows, err := stmtQueryContext(ctx, stmt, req, params...)
 			if err != nil {
 				slog.ErrorContext(ctx, req+"\n"+err.Error()+"\n"+debugStack(), "event", "psql:insert_ignore:run_fail", "psql.table", tableName)
 				return &Error{Query: req, Err: err}
 			}
 			// ON CONFLICT DO NOTHING may produce no rows if conflict occurred
-			if rows.Next() {
+			inserted = rows.Next()
+			if inserted {
 				if err := t.scanValueReturning(ctx, rows, target); err != nil {
 					rows.Close()
 					return err
@@ -209,11 +248,24 @@ func (t *TableMeta[T]) InsertIgnore(ctx context.Context, targets ...*T) error {
 			}
 			rows.Close()
 		} else {
-			_, err := stmt.ExecContext(ctx, params...)
+			res, err := stmtExecContext(ctx, stmt, req, params...)
 			if err != nil {
 				slog.ErrorContext(ctx, req+"\n"+err.Error()+"\n"+debugStack(), "event", "psql:insert_ignore:run_fail", "psql.table", tableName)
 				return &Error{Query: req, Err: err}
 			}
+			if t.history {
+				n, err := res.RowsAffected()
+				if err != nil {
+					return err
+				}
+				inserted = n > 0
+			}
+		}
+
+		if t.history && inserted {
+			if err := t.recordHistory(ctx, "insert_ignore", val, nil, t.rowValues(val)); err != nil {
+				return err
+			}
 		}
 
 		if h, ok := any(target).(AfterInsertHook); ok {
@@ -0,0 +1,145 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// QueryKind identifies the kind of statement reported in a [QueryEvent].
+type QueryKind int
+
+const (
+	QueryExec    QueryKind = iota // statement executed with ExecContext
+	QueryRows                     // statement returning rows
+	QueryPrepare                  // statement being prepared
+	QueryStmt                     // execution of a prepared statement
+)
+
+func (k QueryKind) String() string {
+	switch k {
+	case QueryExec:
+		return "exec"
+	case QueryRows:
+		return "query"
+	case QueryPrepare:
+		return "prepare"
+	case QueryStmt:
+		return "stmt"
+	default:
+		return "unknown"
+	}
+}
+
+// QueryEvent describes a SQL statement passed to an [Interceptor]. Duration,
+// RowsAffected and Err are only set when calling [Interceptor.AfterQuery].
+type QueryEvent struct {
+	Kind  QueryKind
+	Query string
+	Args  []any
+
+	Duration     time.Duration
+	RowsAffected int64 // -1 when unknown (queries returning rows, prepare)
+	Err          error
+}
+
+// Interceptor observes every SQL statement run through a [Backend], whether
+// it comes from typed operations, the query builder or raw queries. Register
+// one with [Backend.Intercept] or [WithInterceptor].
+//
+// BeforeQuery may rewrite ev.Query and ev.Args (for example to add a
+// comment), or return an error to prevent the statement from running; the
+// error is then returned to the caller. AfterQuery is called once the
+// statement completed, including when it failed; when a BeforeQuery prevents
+// the statement from running, it is only called on the interceptors whose
+// BeforeQuery already succeeded. For prepared statements, the
+// query can only be rewritten when it is prepared.
+type Interceptor interface {
+	BeforeQuery(ctx context.Context, ev *QueryEvent) error
+	AfterQuery(ctx context.Context, ev *QueryEvent)
+}
+
+// WithInterceptor registers an [Interceptor] on the backend.
+func WithInterceptor(i Interceptor) BackendOption {
+	return func(b *Backend) {
+		b.Intercept(i)
+	}
+}
+
+// Intercept registers interceptors on the backend. They are called in
+// registration order. It should be called during setup, before the backend is
+// used concurrently.
+func (be *Backend) Intercept(i ...Interceptor) {
+	if be == nil {
+		return
+	}
+	be.extLk.Lock()
+	defer be.extLk.Unlock()
+	be.interceptors = append(append([]Interceptor(nil), be.interceptors...), i...)
+}
+
+func (be *Backend) getInterceptors() []Interceptor {
+	if be == nil {
+		return nil
+	}
+	be.extLk.RLock()
+	defer be.extLk.RUnlock()
+	return be.interceptors
+}
+
+// intercept runs a statement through the interceptors of the current backend.
+// affected extracts the number of affected rows from the result, if any.
+func intercept[R any](ctx context.Context, kind QueryKind, query string, args []any, run func(ctx context.Context, query string, args ...any) (R, error), affected func(R) int64) (R, error) {
+	traceStatement(ctx, query)
+	list := GetBackend(ctx).getInterceptors()
+	if len(list) == 0 {
+		return run(ctx, query, args...)
+	}
+
+	ev := &QueryEvent{Kind: kind, Query: query, Args: args, RowsAffected: -1}
+	for n, i := range list {
+		if err := i.BeforeQuery(ctx, ev); err != nil {
+			var zero R
+			ev.Err = err
+			for _, i := range list[:n] {
+				i.AfterQuery(ctx, ev)
+			}
+			return zero, err
+		}
+	}
+
+	start := time.Now()
+	res, err := run(ctx, ev.Query, ev.Args...)
+	ev.Duration = time.Since(start)
+	ev.Err = err
+	if err == nil && affected != nil {
+		ev.RowsAffected = affected(res)
+	}
+	for _, i := range list {
+		i.AfterQuery(ctx, ev)
+	}
+	return res, err
+}
+
+func resultRowsAffected(r sql.Result) int64 {
+	n, err := r.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// stmtExecContext runs a prepared statement through the interceptors. query
+// is the statement's SQL, used for reporting only.
+func stmtExecContext(ctx context.Context, stmt *sql.Stmt, query string, args ...any) (sql.Result, error) {
+	return intercept(ctx, QueryStmt, query, args, func(ctx context.Context, _ string, args ...any) (sql.Result, error) {
+		return stmt.ExecContext(ctx, args...)
+	}, resultRowsAffected)
+}
+
+// stmtQueryContext is like stmtExecContext for statements returning rows.
+func stmtQueryContext(ctx context.Context, stmt *sql.Stmt, query string, args ...any) (*sql.Rows, error) {
+	return intercept(ctx, QueryStmt, query, args, func(ctx context.Context, _ string, args ...any) (*sql.Rows, error) {
+		return stmt.QueryContext(ctx, args...)
+	}, nil)
+}
@@ -0,0 +1,111 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingInterceptor struct {
+	events []psql.QueryEvent
+	before func(ev *psql.QueryEvent) error
+}
+
+func (r *recordingInterceptor) BeforeQuery(ctx context.Context, ev *psql.QueryEvent) error {
+	if r.before != nil {
+		return r.before(ev)
+	}
+	return nil
+}
+
+func (r *recordingInterceptor) AfterQuery(ctx context.Context, ev *psql.QueryEvent) {
+	r.events = append(r.events, *ev)
+}
+
+func TestInterceptorExec(t *testing.T) {
+	db, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+	db.OnExec = func(q string, args []driver.Value) (driver.Result, error) {
+		return driver.RowsAffected(3), nil
+	}
+	rec := &recordingInterceptor{}
+	be.Intercept(rec)
+
+	_, err := psql.Delete[hookedDoc](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+
+	require.Len(t, rec.events, 1)
+	ev := rec.events[0]
+	assert.Equal(t, psql.QueryExec, ev.Kind)
+	assert.True(t, strings.HasPrefix(ev.Query, `DELETE FROM "hooked_docs"`))
+	assert.Equal(t, int64(3), ev.RowsAffected)
+	assert.NoError(t, ev.Err)
+}
+
+func TestInterceptorPreparedInsert(t *testing.T) {
+	_, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+	rec := &recordingInterceptor{}
+	be.Intercept(rec)
+
+	require.NoError(t, psql.Insert(ctx, &hookedDoc{ID: 1}, &hookedDoc{ID: 2}))
+
+	var kinds []psql.QueryKind
+	for _, ev := range rec.events {
+		kinds = append(kinds, ev.Kind)
+	}
+	assert.Equal(t, []psql.QueryKind{psql.QueryPrepare, psql.QueryStmt, psql.QueryStmt}, kinds)
+	assert.Equal(t, int64(1), rec.events[1].RowsAffected)
+}
+
+func TestInterceptorRewriteAndError(t *testing.T) {
+	db, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+	db.OnExec = func(q string, args []driver.Value) (driver.Result, error) {
+		return nil, errors.New("boom")
+	}
+	rec := &recordingInterceptor{before: func(ev *psql.QueryEvent) error {
+		ev.Query = "/* app=test */ " + ev.Query
+		return nil
+	}}
+	be.Intercept(rec)
+
+	err := psql.Q("DELETE FROM x").Exec(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, "/* app=test */ DELETE FROM x", db.Last().Query)
+	require.Len(t, rec.events, 1)
+	assert.EqualError(t, rec.events[0].Err, "boom")
+}
+
+func TestInterceptorVeto(t *testing.T) {
+	db, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+	errBlocked := errors.New("blocked")
+	be.Intercept(&recordingInterceptor{before: func(ev *psql.QueryEvent) error {
+		return errBlocked
+	}})
+
+	_, err := psql.Fetch[hookedDoc](ctx, nil)
+	assert.ErrorIs(t, err, errBlocked)
+	assert.Empty(t, db.Queries())
+}
+
+func TestInterceptorVetoUnwind(t *testing.T) {
+	_, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+	errBlocked := errors.New("blocked")
+	first := &recordingInterceptor{}
+	veto := &recordingInterceptor{before: func(ev *psql.QueryEvent) error {
+		return errBlocked
+	}}
+	last := &recordingInterceptor{}
+	be.Intercept(first, veto, last)
+
+	assert.ErrorIs(t, psql.Q("DELETE FROM x").Exec(ctx), errBlocked)
+	require.Len(t, first.events, 1)
+	assert.ErrorIs(t, first.events[0].Err, errBlocked)
+	assert.Empty(t, veto.events)
+	assert.Empty(t, last.events, "BeforeQuery never ran")
+}
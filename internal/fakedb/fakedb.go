@@ -0,0 +1,213 @@
+// Package fakedb provides a minimal database/sql driver recording every
+// statement it receives, shared by the tests of psql and its subpackages. It
+// lets tests exercise the object-level CRUD paths without a real database
+// engine.
+package fakedb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/portablesql/psql"
+)
+
+// DB is a fake database, usable as a [driver.Connector]. Exec and query
+// results can be customized through the OnExec and OnQuery callbacks.
+type DB struct {
+	OnExec  func(q string, args []driver.Value) (driver.Result, error)
+	OnQuery func(q string, args []driver.Value) (*Rows, error)
+
+	mu      sync.Mutex
+	queries []Query
+	txOpts  []driver.TxOptions
+}
+
+// Query is a statement received by a [DB].
+type Query struct {
+	Query string
+	Args  []driver.Value
+	InTx  bool // run in a transaction
+}
+
+// Rows holds a static result set returned by OnQuery.
+type Rows struct {
+	Cols []string
+	Data [][]driver.Value
+	pos  int
+}
+
+// New returns a fake database and a context carrying a backend for the given
+// engine connected to it.
+func New(t testing.TB, e psql.Engine) (*DB, context.Context) {
+	t.Helper()
+	f, _, ctx := NewBackend(t, e)
+	return f, ctx
+}
+
+// NewBackend is like [New] but also returns the backend.
+func NewBackend(t testing.TB, e psql.Engine) (*DB, *psql.Backend, context.Context) {
+	t.Helper()
+	f := &DB{}
+	db := sql.OpenDB(f)
+	t.Cleanup(func() { db.Close() })
+	be := psql.NewBackend(e, db)
+	return f, be, be.Plug(context.Background())
+}
+
+// Queries returns the list of statements received so far.
+func (f *DB) Queries() []Query {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Query(nil), f.queries...)
+}
+
+// Last returns the last statement received, or an empty value.
+func (f *DB) Last() Query {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.queries) == 0 {
+		return Query{}
+	}
+	return f.queries[len(f.queries)-1]
+}
+
+// Find returns the first statement starting with prefix.
+func (f *DB) Find(prefix string) (Query, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, q := range f.queries {
+		if strings.HasPrefix(q.Query, prefix) {
+			return q, true
+		}
+	}
+	return Query{}, false
+}
+
+// TxOpts returns the options of the transactions started so far.
+func (f *DB) TxOpts() []driver.TxOptions {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]driver.TxOptions(nil), f.txOpts...)
+}
+
+func (f *DB) record(c *conn, q string, args []driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, Query{Query: q, Args: args, InTx: c.inTx})
+}
+
+// driver.Connector
+
+func (f *DB) Connect(context.Context) (driver.Conn, error) { return &conn{f: f}, nil }
+func (f *DB) Driver() driver.Driver                        { return fakeDriver{f} }
+
+type fakeDriver struct{ f *DB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return &conn{f: d.f}, nil }
+
+type conn struct {
+	f    *DB
+	inTx bool
+}
+
+func (c *conn) Prepare(q string) (driver.Stmt, error) { return &stmt{c, q}, nil }
+func (c *conn) Close() error                          { return nil }
+func (c *conn) Begin() (driver.Tx, error) {
+	c.f.record(c, "BEGIN", nil)
+	c.inTx = true
+	return &tx{c}, nil
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.f.mu.Lock()
+	c.f.txOpts = append(c.f.txOpts, opts)
+	c.f.mu.Unlock()
+	return c.Begin()
+}
+
+func (c *conn) ExecContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Result, error) {
+	return c.exec(q, namedToValues(args))
+}
+
+func (c *conn) QueryContext(ctx context.Context, q string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.query(q, namedToValues(args))
+}
+
+func (c *conn) exec(q string, args []driver.Value) (driver.Result, error) {
+	c.f.record(c, q, args)
+	if c.f.OnExec != nil {
+		return c.f.OnExec(q, args)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *conn) query(q string, args []driver.Value) (driver.Rows, error) {
+	c.f.record(c, q, args)
+	if c.f.OnQuery != nil {
+		r, err := c.f.OnQuery(q, args)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			return r, nil
+		}
+	}
+	return &Rows{}, nil
+}
+
+type tx struct{ c *conn }
+
+func (t *tx) Commit() error {
+	t.c.inTx = false
+	t.c.f.record(t.c, "COMMIT", nil)
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	t.c.inTx = false
+	t.c.f.record(t.c, "ROLLBACK", nil)
+	return nil
+}
+
+type stmt struct {
+	c *conn
+	q string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.exec(s.q, args)
+}
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.query(s.q, args)
+}
+
+func (r *Rows) Columns() []string { return r.Cols }
+func (r *Rows) Close() error      { return nil }
+func (r *Rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.Data) {
+		return io.EOF
+	}
+	row := r.Data[r.pos]
+	r.pos++
+	if len(row) != len(dest) {
+		return errors.New("fakedb: column count mismatch")
+	}
+	copy(dest, row)
+	return nil
+}
+
+func namedToValues(args []driver.NamedValue) []driver.Value {
+	res := make([]driver.Value, len(args))
+	for i, a := range args {
+		res[i] = a.Value
+	}
+	return res
+}
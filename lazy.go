@@ -2,31 +2,36 @@ package psql
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
 	"strings"
-	"sync"
 	"sync/atomic"
 
 	"github.com/KarpelesLab/pjson"
 )
 
-// Future represents a lazily-loaded database record. Created by [Lazy], it defers
-// the actual database query until [Future.Resolve] is called. When resolved, it
-// automatically batches all pending futures for the same table and column into a
-// single query, significantly reducing database round trips.
+// Future represents a lazily-loaded database record. Created by [Lazy] or
+// [LazyContext], it defers the actual database query until [Future.Resolve] is
+// called. When resolved, it automatically batches all pending futures of its
+// [Loader] for the same table and column into a single query, significantly
+// reducing database round trips.
 //
 // Concurrent Resolve calls share the same result. Future also implements json.Marshaler.
 type Future[T any] struct {
-	col   string
-	val   string
-	obj   *T
-	err   error
-	k     string
-	done  uint32 // atomic: 0=pending, 1=resolved
-	wait  chan struct{}
-	table *TableMeta[T]
+	cols   []string
+	vals   []any
+	match  string // key matching the loaded row, see lazyMatch
+	obj    *T
+	err    error
+	done   uint32 // atomic: 0=pending, 1=resolved
+	wait   chan struct{}
+	table  *TableMeta[T]
+	loader *Loader
+	key    loaderKey
+	batch  *loaderBatch
 }
 
 // Lazy returns an instance of Future that will be resolved in the future. Multiple calls
@@ -34,145 +39,206 @@ type Future[T any] struct {
 //
 // When any Future is resolved, all pending futures for the same table and column are
 // batched into a single WHERE col IN (...) query, reducing database round trips.
+//
+// Futures returned by Lazy are shared by the whole process and loaded with the
+// context of the first Resolve call. Use [LazyContext] with [NewLoader] to
+// scope them to a context.
 func Lazy[T any](col, val string) *Future[T] {
-	t := Table[T]()
-	k := col + "\x00" + val
-
-	v, ok := t.futures.Load(k)
-	if ok {
-		return v.(*Future[T])
-	}
+	return loaderFuture[T](nil, defaultLoader, []string{col}, []any{val})
+}
 
-	newv := &Future[T]{
-		col:   col,
-		val:   val,
-		k:     k,
-		wait:  make(chan struct{}),
-		table: t,
-	}
+// LazyContext is like [Lazy], but registers the future with the [Loader] of
+// ctx if it was created by [NewLoader].
+func LazyContext[T any](ctx context.Context, col, val string) *Future[T] {
+	return loaderFuture[T](ctx, loaderFromContext(ctx), []string{col}, []any{val})
+}
 
-	v, ok = t.futures.LoadOrStore(k, newv)
-	if ok {
-		return v.(*Future[T])
-	}
+// LazyKey returns a Future for the row with the given main key values, in the
+// order of the key columns:
+//
+//	f := psql.LazyKey[Member](orgID, userID)
+//
+// Values are matched with the loaded rows as typed by the key fields rather
+// than as text, so binary and UUID keys are supported. Pending futures of a
+// composite key are loaded together with a WHERE (a=? AND b=?) OR ... query.
+func LazyKey[T any](key ...any) *Future[T] {
+	return lazyKey[T](nil, defaultLoader, key)
+}
 
-	return newv
+// LazyKeyContext is like [LazyKey], but registers the future with the
+// [Loader] of ctx if it was created by [NewLoader].
+func LazyKeyContext[T any](ctx context.Context, key ...any) *Future[T] {
+	return lazyKey[T](ctx, loaderFromContext(ctx), key)
 }
 
-func (f *Future[T]) Resolve(ctx context.Context) (*T, error) {
-	if atomic.LoadUint32(&f.done) == 1 {
-		return f.obj, f.err
+func lazyKey[T any](ctx context.Context, l *Loader, key []any) *Future[T] {
+	t := Table[T]()
+	if t.mainKey == nil {
+		return &Future[T]{err: errors.New("cannot load objects without a unique key"), done: 1, table: t}
 	}
-
-	if ctx == nil {
-		ctx = context.Background()
+	if len(key) != len(t.mainKey.Fields) {
+		return &Future[T]{err: fmt.Errorf("key of %s has %d columns, got %d values", t.table, len(t.mainKey.Fields), len(key)), done: 1, table: t}
 	}
-
-	// Try to be the resolver for this future
-	f.resolve(ctx)
-
-	// Wait until resolved (by us or by a batch leader)
-	<-f.wait
-	return f.obj, f.err
+	return loaderFuture[T](ctx, l, t.mainKey.Fields, key)
 }
 
-// resolveMu serializes batch resolution for a given table to prevent
-// concurrent leaders from seeing the same peers.
-var resolveMu sync.Mutex
-
-func (f *Future[T]) resolve(ctx context.Context) {
-	// Quick check: already resolved by a batch leader
-	if atomic.LoadUint32(&f.done) == 1 {
-		return
+// where returns the where clause loading f alone.
+func (f *Future[T]) where() map[string]any {
+	res := make(map[string]any, len(f.cols))
+	for n, col := range f.cols {
+		res[col] = f.vals[n]
 	}
+	return res
+}
 
-	resolveMu.Lock()
-	// Double-check after acquiring lock
-	if atomic.LoadUint32(&f.done) == 1 {
-		resolveMu.Unlock()
-		return
+func (f *Future[T]) Resolve(ctx context.Context) (*T, error) {
+	if ctx == nil {
+		ctx = context.Background()
+		if f.loader != nil && f.loader.ctx != nil {
+			ctx = f.loader.ctx
+		}
 	}
-
-	// Check if another leader already claimed us as a peer
-	if _, stillInMap := f.table.futures.Load(f.k); !stillInMap {
-		resolveMu.Unlock()
-		return
+	if obj := f.table.identityGet(ctx, f.where(), nil); obj != nil {
+		return obj, nil
 	}
 
-	// Collect all pending futures for the same column
-	prefix := f.col + "\x00"
-	var peers []*Future[T]
-
-	f.table.futures.Range(func(key, value any) bool {
-		k := key.(string)
-		peer := value.(*Future[T])
-		if peer != f && strings.HasPrefix(k, prefix) && atomic.LoadUint32(&peer.done) == 0 {
-			peers = append(peers, peer)
+	if atomic.LoadUint32(&f.done) == 0 {
+		if f.key.tx != nil {
+			if tx := txFromContext(ctx); tx == nil || tx.ctrl != f.key.tx {
+				return nil, ErrFutureTx
+			}
+		}
+		if f.loader.window == 0 {
+			// Resolve the batch now, unless it already is
+			f.loader.dispatch(ctx, f.key, f.batch)
 		}
-		return true
-	})
 
-	// Remove self and peers from the futures map so no other leader claims them
-	f.table.futures.Delete(f.k)
-	for _, p := range peers {
-		f.table.futures.Delete(p.k)
+		// Wait until resolved (by us, another caller or the loader)
+		<-f.wait
+	}
+	if f.err != nil {
+		return nil, f.err
 	}
+	return f.table.identityAdd(ctx, f.obj, false), nil
+}
+
+// fail resolves f with err.
+func (f *Future[T]) fail(err error) {
+	f.err = err
+	atomic.StoreUint32(&f.done, 1)
+	close(f.wait)
+}
 
-	resolveMu.Unlock()
+// resolveFutures loads the given futures of t for cols, and resolves them.
+func resolveFutures[T any](ctx context.Context, t *TableMeta[T], cols []string, futures []any) {
+	batch := make([]*Future[T], len(futures))
+	for n, v := range futures {
+		batch[n] = v.(*Future[T])
+	}
 
-	// Now resolve outside the lock
-	if len(peers) == 0 {
+	if len(batch) == 1 {
 		// Single fetch
-		f.obj, f.err = f.table.Get(ctx, map[string]any{f.col: f.val})
+		f := batch[0]
+		f.obj, f.err = t.Get(ctx, f.where())
 		atomic.StoreUint32(&f.done, 1)
 		close(f.wait)
 		return
 	}
 
 	// Batch fetch
-	vals := make([]any, 0, len(peers)+1)
-	vals = append(vals, f.val)
-	for _, p := range peers {
-		vals = append(vals, p.val)
+	var where any
+	text := false
+	if len(cols) == 1 {
+		vals := make([]any, 0, len(batch))
+		for _, f := range batch {
+			vals = append(vals, f.vals[0])
+		}
+		where = map[string]any{cols[0]: vals}
+	} else {
+		or := make(WhereOR, 0, len(batch))
+		for _, f := range batch {
+			or = append(or, WhereAND{f.where()})
+		}
+		where = or
+	}
+	for _, f := range batch {
+		if isLazyText(f.match) {
+			text = true
+		}
 	}
 
-	results, err := f.table.Fetch(ctx, map[string]any{f.col: vals})
+	results, err := t.Fetch(ctx, where)
 
-	// Build result index by column value (as string)
-	resultByVal := make(map[string]*T)
+	// Build result index by match key
+	resultByKey := make(map[string]*T)
 	if err == nil {
-		fld := f.table.fldcol[f.col]
-		if fld != nil {
+		flds := make([]*StructField, len(cols))
+		for n, col := range cols {
+			flds[n] = findFieldByNameOrCol(t.fldcol, col)
+			if flds[n] == nil {
+				err = fmt.Errorf("unknown column %s in %s", col, t.table)
+			}
+		}
+		if err == nil {
+			vals := make([]any, len(cols))
 			for _, r := range results {
-				key := fmt.Sprintf("%v", reflect.ValueOf(r).Elem().Field(fld.Index).Interface())
-				resultByVal[key] = r
+				rv := reflect.ValueOf(r).Elem()
+				for n, fld := range flds {
+					vals[n] = rv.Field(fld.Index).Interface()
+				}
+				resultByKey[t.lazyMatch(cols, vals)] = r
+				if text {
+					resultByKey[lazyText(vals)] = r
+				}
 			}
 		}
 	}
 
-	// Set our own result
-	if err != nil {
-		f.err = err
-	} else if obj, ok := resultByVal[f.val]; ok {
-		f.obj = obj
-	} else {
-		f.err = os.ErrNotExist
-	}
-	atomic.StoreUint32(&f.done, 1)
-	close(f.wait)
-
-	// Distribute results to peers
-	for _, p := range peers {
+	// Distribute results
+	for _, f := range batch {
 		if err != nil {
-			p.err = err
-		} else if obj, ok := resultByVal[p.val]; ok {
-			p.obj = obj
+			f.err = err
+		} else if obj, ok := resultByKey[f.match]; ok {
+			f.obj = obj
 		} else {
-			p.err = os.ErrNotExist
+			f.err = os.ErrNotExist
+		}
+		atomic.StoreUint32(&f.done, 1)
+		close(f.wait)
+	}
+}
+
+// lazyMatch returns the key matching a future for vals in cols with the rows
+// holding the same values. Values are compared as typed by the struct fields,
+// converted like the main key values of the identity map, or as text when
+// they cannot be converted.
+func (t *TableMeta[T]) lazyMatch(cols []string, vals []any) string {
+	typed := make([]any, len(vals))
+	for n, v := range vals {
+		f := findFieldByNameOrCol(t.fldcol, cols[n])
+		if f == nil || v == nil {
+			return lazyText(vals)
+		}
+		rv, ok := identityConvert(reflect.ValueOf(v), t.typ.Field(f.Index).Type)
+		if !ok {
+			return lazyText(vals)
 		}
-		atomic.StoreUint32(&p.done, 1)
-		close(p.wait)
+		typed[n] = rv.Interface()
+	}
+	key, err := json.Marshal(typed)
+	if err != nil {
+		return lazyText(vals)
 	}
+	return string(key)
+}
+
+// lazyText returns the text match key of vals.
+func lazyText(vals []any) string {
+	return "\x00" + fmt.Sprintf("%v", vals)
+}
+
+func isLazyText(match string) bool {
+	return strings.HasPrefix(match, "\x00")
 }
 
 func (f *Future[T]) MarshalJSON() ([]byte, error) {
@@ -0,0 +1,84 @@
+package psql_test
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type lazyMember struct {
+	psql.Name `sql:"lazy_members"`
+	OrgID     uint64
+	UserID    uint64
+	Role      string   `sql:",type=VARCHAR,size=32"`
+	Key       psql.Key `sql:"PRIMARY,type=PRIMARY,fields='OrgID,UserID'"`
+}
+
+type lazyBlob struct {
+	psql.Name `sql:"lazy_blobs"`
+	ID        []byte `sql:",key=PRIMARY,type=VARBINARY,size=16"`
+	Label     string `sql:",type=VARCHAR,size=32"`
+}
+
+func TestLazyKeyComposite(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{
+			Cols: []string{"OrgID", "UserID", "Role"},
+			Data: [][]driver.Value{{int64(2), int64(10), "c"}, {int64(1), int64(20), "b"}, {int64(1), int64(10), "a"}},
+		}, nil
+	}
+	ctx = psql.NewLoader(ctx)
+
+	f1 := psql.LazyKeyContext[lazyMember](ctx, 1, 10)
+	f2 := psql.LazyKeyContext[lazyMember](ctx, uint64(1), 20)
+	f3 := psql.LazyKeyContext[lazyMember](ctx, "2", 10)
+	missing := psql.LazyKeyContext[lazyMember](ctx, 3, 3)
+	assert.Same(t, f1, psql.LazyKeyContext[lazyMember](ctx, int64(1), uint(10)), "values are compared as typed by the key fields")
+
+	m, err := f1.Resolve(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "a", m.Role)
+	m, err = f2.Resolve(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "b", m.Role)
+	m, err = f3.Resolve(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "c", m.Role)
+	_, err = missing.Resolve(ctx)
+	assert.True(t, psql.IsNotExist(err))
+
+	require.Len(t, db.Queries(), 1)
+	assert.Contains(t, db.Last().Query, `WHERE ((("OrgID"=? AND "UserID"=?)) OR (("OrgID"=? AND "UserID"=?)) OR `)
+}
+
+func TestLazyKeyBinary(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{
+			Cols: []string{"ID", "Label"},
+			Data: [][]driver.Value{{[]byte{0xde, 0xad}, "dead"}, {[]byte{0xbe, 0xef}, "beef"}},
+		}, nil
+	}
+	ctx = psql.NewLoader(ctx)
+
+	f1 := psql.LazyKeyContext[lazyBlob](ctx, []byte{0xbe, 0xef})
+	f2 := psql.LazyKeyContext[lazyBlob](ctx, []byte{0xde, 0xad})
+
+	b, err := f1.Resolve(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "beef", b.Label)
+	b, err = f2.Resolve(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "dead", b.Label)
+	assert.Len(t, db.Queries(), 1)
+}
+
+func TestLazyKeyInvalid(t *testing.T) {
+	_, err := psql.LazyKey[lazyMember](1).Resolve(nil)
+	assert.Error(t, err)
+}
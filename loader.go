@@ -0,0 +1,203 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ctxLoaderKey struct{}
+
+// Loader owns the pending futures created by [LazyContext] on a context
+// returned by [NewLoader], and batches their resolution by table and column.
+type Loader struct {
+	ctx      context.Context // nil for the default loader
+	maxBatch int
+	window   time.Duration
+
+	lk      sync.Mutex
+	pending map[loaderKey]*loaderBatch
+}
+
+// LoaderOption configures a [Loader] created by [NewLoader].
+type LoaderOption func(*Loader)
+
+// LoaderMaxBatch limits the number of values loaded by a single query. Larger
+// batches are split in several queries.
+func LoaderMaxBatch(n int) LoaderOption {
+	return func(l *Loader) {
+		l.maxBatch = n
+	}
+}
+
+// LoaderWindow delays the resolution of a batch until d elapsed after its
+// first future was created, instead of resolving it when a future is first
+// resolved. This allows futures created concurrently, for example by GraphQL
+// resolvers, to be loaded together.
+func LoaderWindow(d time.Duration) LoaderOption {
+	return func(l *Loader) {
+		l.window = d
+	}
+}
+
+// NewLoader returns a context holding a new [Loader], scoping the futures
+// created with [LazyContext] to it, typically for the duration of an HTTP
+// request:
+//
+//	ctx = psql.NewLoader(ctx)
+//	author := psql.LazyContext[User](ctx, "ID", post.AuthorID)
+//
+// Futures of a loader only batch with each other, and with those created in
+// the same transaction. A batch is loaded with the context of the Resolve call
+// dispatching it, which must be in the transaction its futures were created
+// in, if any, or [ErrFutureTx] is returned. Futures still pending when their
+// transaction ends fail with [sql.ErrTxDone].
+func NewLoader(ctx context.Context, opts ...LoaderOption) context.Context {
+	l := newLoader()
+	for _, opt := range opts {
+		opt(l)
+	}
+	ctx = context.WithValue(ctx, ctxLoaderKey{}, l)
+	l.ctx = ctx
+	return ctx
+}
+
+// defaultLoader holds the futures created by [Lazy], or by [LazyContext]
+// without a loader, for the whole process.
+var defaultLoader = newLoader()
+
+func newLoader() *Loader {
+	return &Loader{pending: make(map[loaderKey]*loaderBatch)}
+}
+
+func loaderFromContext(ctx context.Context) *Loader {
+	if ctx != nil {
+		if l, ok := ctx.Value(ctxLoaderKey{}).(*Loader); ok {
+			return l
+		}
+	}
+	return defaultLoader
+}
+
+type loaderKey struct {
+	typ reflect.Type
+	col string        // columns, separated by \x00
+	tx  *txController // transaction the futures were created in
+}
+
+// loaderBatch holds the pending futures of a table and column.
+type loaderBatch struct {
+	futures map[string]any // *Future[T] by match key
+	order   []any
+	resolve func(ctx context.Context, futures []any)
+	fail    func(futures []any, err error)
+	timer   *time.Timer
+}
+
+// loaderFuture returns the pending future of l for the given column values,
+// creating it if needed. ctx is the context the future is created with, nil
+// for [Lazy] and [LazyKey].
+func loaderFuture[T any](ctx context.Context, l *Loader, cols []string, vals []any) *Future[T] {
+	t := Table[T]()
+	k := loaderKey{typ: t.typ, col: strings.Join(cols, "\x00")}
+	if ctx == nil {
+		ctx = l.ctx
+	}
+	if ctx != nil {
+		if tx := txFromContext(ctx); tx != nil {
+			k.tx = tx.ctrl
+		}
+	}
+	match := t.lazyMatch(cols, vals)
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	b := l.pending[k]
+	if b == nil {
+		b = &loaderBatch{
+			futures: make(map[string]any),
+			resolve: func(ctx context.Context, futures []any) {
+				resolveFutures[T](ctx, t, cols, futures)
+			},
+			fail: func(futures []any, err error) {
+				for _, f := range futures {
+					f.(*Future[T]).fail(err)
+				}
+			},
+		}
+		l.pending[k] = b
+		if l.window > 0 {
+			b.timer = time.AfterFunc(l.window, func() {
+				l.dispatch(ctx, k, b)
+			})
+		}
+		if k.tx != nil {
+			// the transaction cannot load the batch once it ended
+			end := func(context.Context) {
+				l.abort(k, b, sql.ErrTxDone)
+			}
+			AfterCommit(ctx, end)
+			AfterRollback(ctx, end)
+		}
+	}
+	if f, ok := b.futures[match]; ok {
+		return f.(*Future[T])
+	}
+	f := &Future[T]{
+		cols:   cols,
+		vals:   vals,
+		match:  match,
+		wait:   make(chan struct{}),
+		table:  t,
+		loader: l,
+		key:    k,
+		batch:  b,
+	}
+	b.futures[match] = f
+	b.order = append(b.order, f)
+	return f
+}
+
+// take removes b from the pending batches of l, and reports whether it was
+// still pending.
+func (l *Loader) take(k loaderKey, b *loaderBatch) bool {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if l.pending[k] != b {
+		// already dispatched
+		return false
+	}
+	delete(l.pending, k)
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	return true
+}
+
+// dispatch resolves the futures of b with ctx, unless it was already
+// dispatched.
+func (l *Loader) dispatch(ctx context.Context, k loaderKey, b *loaderBatch) {
+	if !l.take(k, b) {
+		return
+	}
+	futures := b.order
+	for len(futures) > 0 {
+		n := len(futures)
+		if l.maxBatch > 0 && n > l.maxBatch {
+			n = l.maxBatch
+		}
+		b.resolve(ctx, futures[:n])
+		futures = futures[n:]
+	}
+}
+
+// abort fails the futures of b with err, unless it was already dispatched.
+func (l *Loader) abort(k loaderKey, b *loaderBatch, err error) {
+	if l.take(k, b) {
+		b.fail(b.order, err)
+	}
+}
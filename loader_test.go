@@ -0,0 +1,167 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type loaderUser struct {
+	psql.Name `sql:"loader_users"`
+	ID        uint64 `sql:",key=PRIMARY"`
+	Email     string `sql:",type=VARCHAR,size=128"`
+}
+
+// loaderBackend returns one row per numeric argument of each query.
+func loaderBackend(t *testing.T) (*fakedb.DB, context.Context) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		res := &fakedb.Rows{Cols: []string{"ID", "Email"}}
+		for _, a := range args {
+			if s, ok := a.(string); ok {
+				a, _ = strconv.ParseInt(s, 10, 64)
+			}
+			if id, ok := a.(int64); ok && id > 0 {
+				res.Data = append(res.Data, []driver.Value{id, "user" + strconv.FormatInt(id, 10) + "@example.com"})
+			}
+		}
+		return res, nil
+	}
+	return db, ctx
+}
+
+func TestLoaderBatch(t *testing.T) {
+	db, ctx := loaderBackend(t)
+	ctx = psql.NewLoader(ctx)
+
+	f1 := psql.LazyContext[loaderUser](ctx, "ID", "1")
+	f2 := psql.LazyContext[loaderUser](ctx, "ID", "2")
+	assert.Same(t, f1, psql.LazyContext[loaderUser](ctx, "ID", "1"))
+
+	u2, err := f2.Resolve(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "user2@example.com", u2.Email)
+	u1, err := f1.Resolve(nil)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), u1.ID)
+	require.Len(t, db.Queries(), 1)
+	assert.Contains(t, db.Last().Query, `"ID" IN(?,?)`)
+}
+
+func TestLoaderScope(t *testing.T) {
+	db, ctx := loaderBackend(t)
+	a := psql.NewLoader(ctx)
+	b := psql.NewLoader(ctx)
+
+	fa := psql.LazyContext[loaderUser](a, "ID", "1")
+	fb := psql.LazyContext[loaderUser](b, "ID", "1")
+	assert.NotSame(t, fa, fb)
+	psql.LazyContext[loaderUser](b, "ID", "2")
+
+	_, err := fa.Resolve(ctx)
+	require.NoError(t, err)
+	require.Len(t, db.Queries(), 1)
+	assert.Equal(t, []driver.Value{"1"}, db.Last().Args, "futures of other loaders are not loaded")
+}
+
+func TestLoaderTx(t *testing.T) {
+	db, ctx := loaderBackend(t)
+	ctx = psql.NewLoader(ctx)
+
+	outside := psql.LazyContext[loaderUser](ctx, "ID", "1")
+	var late *psql.Future[loaderUser]
+	require.NoError(t, psql.Tx(ctx, func(ctx context.Context) error {
+		f := psql.LazyContext[loaderUser](ctx, "ID", "2")
+		_, err := f.Resolve(context.Background())
+		assert.ErrorIs(t, err, psql.ErrFutureTx)
+
+		u, err := f.Resolve(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), u.ID)
+		assert.Equal(t, []driver.Value{"2"}, db.Last().Args, "futures created outside of the transaction are batched apart")
+		late = psql.LazyContext[loaderUser](ctx, "ID", "3")
+		return nil
+	}))
+
+	// the transaction ended before the future was resolved
+	n := len(db.Queries())
+	_, err := late.Resolve(ctx)
+	assert.ErrorIs(t, err, sql.ErrTxDone)
+	assert.Len(t, db.Queries(), n)
+
+	_, err = outside.Resolve(ctx)
+	require.NoError(t, err)
+}
+
+func TestLoaderWindowTx(t *testing.T) {
+	db, ctx := loaderBackend(t)
+
+	var f *psql.Future[loaderUser]
+	require.NoError(t, psql.Tx(ctx, func(ctx context.Context) error {
+		ctx = psql.NewLoader(ctx, psql.LoaderWindow(10*time.Millisecond))
+		f = psql.LazyContext[loaderUser](ctx, "ID", "1")
+		return nil
+	}))
+	time.Sleep(30 * time.Millisecond)
+
+	_, found := db.Find("SELECT")
+	assert.False(t, found, "the batch does not fire after commit")
+	_, err := f.Resolve(ctx)
+	assert.ErrorIs(t, err, sql.ErrTxDone)
+}
+
+func TestLoaderMaxBatch(t *testing.T) {
+	db, ctx := loaderBackend(t)
+	ctx = psql.NewLoader(ctx, psql.LoaderMaxBatch(2))
+
+	var futures []*psql.Future[loaderUser]
+	for _, id := range []string{"1", "2", "3"} {
+		futures = append(futures, psql.LazyContext[loaderUser](ctx, "ID", id))
+	}
+	for _, f := range futures {
+		_, err := f.Resolve(ctx)
+		require.NoError(t, err)
+	}
+	assert.Len(t, db.Queries(), 2)
+}
+
+func TestLoaderWindow(t *testing.T) {
+	db, ctx := loaderBackend(t)
+	ctx = psql.NewLoader(ctx, psql.LoaderWindow(10*time.Millisecond))
+
+	var wg sync.WaitGroup
+	for _, id := range []string{"1", "2", "3"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			u, err := psql.LazyContext[loaderUser](ctx, "ID", id).Resolve(ctx)
+			if assert.NoError(t, err) {
+				assert.Equal(t, id, strconv.FormatUint(u.ID, 10))
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, db.Queries(), 1)
+}
+
+func TestLazyDefaultLoader(t *testing.T) {
+	db, ctx := loaderBackend(t)
+
+	f1 := psql.Lazy[loaderUser]("Email", "a@example.com")
+	psql.Lazy[loaderUser]("Email", "b@example.com")
+	assert.Same(t, f1, psql.LazyContext[loaderUser](ctx, "Email", "a@example.com"), "contexts without a loader use the default one")
+
+	_, err := f1.Resolve(ctx)
+	assert.True(t, psql.IsNotExist(err))
+	require.Len(t, db.Queries(), 1)
+	assert.Contains(t, db.Last().Query, `"Email" IN(?,?)`)
+}
@@ -0,0 +1,208 @@
+package psql
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// LockProvider is implemented by dialects providing named (advisory) locks,
+// used by [WithLock]. The context passed to its methods is pinned to the
+// connection (or transaction) holding the lock, so queries run with it use
+// the same session.
+//
+// Engines without a dialect implementing LockProvider use built-in
+// providers: pg_advisory_lock on PostgreSQL, GET_LOCK on MySQL, and a lock
+// table on SQLite.
+type LockProvider interface {
+	// AcquireLock takes the named lock, waiting up to timeout, and returns
+	// false if the lock is held by someone else at the end of the wait. If
+	// tx is true, ctx carries a transaction and the lock may be scoped to
+	// it.
+	AcquireLock(ctx context.Context, name string, timeout time.Duration, tx bool) (bool, error)
+
+	// ReleaseLock releases a lock taken by AcquireLock with the same ctx and
+	// tx. Transaction-scoped locks may be released when the transaction ends
+	// instead.
+	ReleaseLock(ctx context.Context, name string, tx bool) error
+}
+
+// WithLock runs cb while holding the named lock, shared by all clients of the
+// database, e.g. to make sure a cron job runs on a single server at a time.
+// It waits up to timeout for the lock (a timeout of zero tries once), and
+// returns [ErrLockTimeout] without calling cb if it could not be taken.
+//
+// Outside of a transaction, the lock is held by a session pinned with
+// [ContextConn] for the duration of cb, and cb receives ctx unchanged. When
+// ctx carries a transaction, the lock is taken in it, and is scoped to the
+// transaction where the engine supports it (PostgreSQL).
+func WithLock(ctx context.Context, name string, timeout time.Duration, cb func(ctx context.Context) error) error {
+	be := GetBackend(ctx)
+	lp := be.lockProvider()
+
+	lockCtx := ctx
+	_, inTx := ctx.Value(ctxDataObj).(*TxProxy)
+	if _, isConn := ctx.Value(ctxDataObj).(*sql.Conn); !inTx && !isConn {
+		conn, err := be.DB().Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		lockCtx = ContextConn(ctx, conn)
+	}
+
+	ok, err := lp.AcquireLock(lockCtx, name, timeout, inTx)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrLockTimeout, name)
+	}
+	defer lp.ReleaseLock(context.WithoutCancel(lockCtx), name, inTx)
+
+	return cb(ctx)
+}
+
+func (be *Backend) lockProvider() LockProvider {
+	if lp, ok := be.Engine().dialect().(LockProvider); ok {
+		return lp
+	}
+	switch be.Engine() {
+	case EnginePostgreSQL:
+		return pgLockProvider{}
+	case EngineMySQL:
+		return mysqlLockProvider{}
+	default:
+		return tableLockProvider{}
+	}
+}
+
+// pollLock calls try until it succeeds or timeout expires.
+func pollLock(ctx context.Context, timeout time.Duration, try func() (bool, error)) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	wait := 10 * time.Millisecond
+	for {
+		ok, err := try()
+		if ok || err != nil {
+			return ok, err
+		}
+		left := time.Until(deadline)
+		if left <= 0 {
+			return false, nil
+		}
+		timer := time.NewTimer(min(wait, left))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		case <-timer.C:
+		}
+		wait = min(wait*2, time.Second)
+	}
+}
+
+// queryBool runs a query returning a single boolean-like value, NULL being
+// false.
+func queryBool(ctx context.Context, query string, args ...any) (bool, error) {
+	rows, err := doQueryContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return false, err
+		}
+		return false, os.ErrNotExist
+	}
+	var v sql.NullBool
+	if err := rows.Scan(&v); err != nil {
+		return false, err
+	}
+	return v.Valid && v.Bool, rows.Close()
+}
+
+// pgLockProvider uses PostgreSQL advisory locks, keyed by a hash of the name.
+type pgLockProvider struct{}
+
+func (pgLockProvider) AcquireLock(ctx context.Context, name string, timeout time.Duration, tx bool) (bool, error) {
+	fn := "pg_try_advisory_lock"
+	if tx {
+		fn = "pg_try_advisory_xact_lock"
+	}
+	return pollLock(ctx, timeout, func() (bool, error) {
+		return queryBool(ctx, "SELECT "+fn+"(hashtextextended($1, 0))", name)
+	})
+}
+
+func (pgLockProvider) ReleaseLock(ctx context.Context, name string, tx bool) error {
+	if tx {
+		// released at the end of the transaction
+		return nil
+	}
+	_, err := queryBool(ctx, "SELECT pg_advisory_unlock(hashtextextended($1, 0))", name)
+	return err
+}
+
+// mysqlLockProvider uses GET_LOCK, which is always session-scoped.
+type mysqlLockProvider struct{}
+
+// mysqlLockName shortens names to the 64 characters accepted by GET_LOCK.
+func mysqlLockName(name string) string {
+	if len(name) <= 64 {
+		return name
+	}
+	h := sha1.Sum([]byte(name))
+	return name[:23] + ":" + hex.EncodeToString(h[:])
+}
+
+func (mysqlLockProvider) AcquireLock(ctx context.Context, name string, timeout time.Duration, tx bool) (bool, error) {
+	return queryBool(ctx, "SELECT GET_LOCK(?, ?)", mysqlLockName(name), timeout.Seconds())
+}
+
+func (mysqlLockProvider) ReleaseLock(ctx context.Context, name string, tx bool) error {
+	_, err := queryBool(ctx, "SELECT RELEASE_LOCK(?)", mysqlLockName(name))
+	return err
+}
+
+// namedLock is a row of the lock table used by tableLockProvider.
+type namedLock struct {
+	Name       `sql:"psql_locks"`
+	LockName   string `sql:",key=PRIMARY,type=VARCHAR,size=255"`
+	Owner      string `sql:",type=VARCHAR,size=255"`
+	AcquiredAt time.Time
+}
+
+// tableLockProvider stores locks as rows of the psql_locks table, for engines
+// without native named locks. A lock left by a crashed process must be
+// removed by deleting its row.
+type tableLockProvider struct{}
+
+func (tableLockProvider) AcquireLock(ctx context.Context, name string, timeout time.Duration, tx bool) (bool, error) {
+	host, _ := os.Hostname()
+	row := &namedLock{
+		LockName:   name,
+		Owner:      fmt.Sprintf("%s:%d", host, os.Getpid()),
+		AcquiredAt: time.Now().UTC(),
+	}
+	return pollLock(ctx, timeout, func() (bool, error) {
+		err := Insert(ctx, row)
+		if IsDuplicate(err) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+}
+
+func (tableLockProvider) ReleaseLock(ctx context.Context, name string, tx bool) error {
+	_, err := Delete[namedLock](ctx, map[string]any{"LockName": name})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lockResult makes the fake database answer lock queries with v.
+func lockResult(v driver.Value) func(q string, args []driver.Value) (*fakedb.Rows, error) {
+	return func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{Cols: []string{"v"}, Data: [][]driver.Value{{v}}}, nil
+	}
+}
+
+func TestWithLockPostgreSQL(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+	db.OnQuery = lockResult(true)
+
+	called := false
+	err := psql.WithLock(ctx, "cron:daily", 0, func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, called)
+
+	q := db.Queries()
+	require.Len(t, q, 2)
+	assert.Equal(t, "SELECT pg_try_advisory_lock(hashtextextended($1, 0))", q[0].Query)
+	assert.Equal(t, []driver.Value{"cron:daily"}, q[0].Args)
+	assert.True(t, strings.HasPrefix(q[1].Query, "SELECT pg_advisory_unlock("))
+}
+
+func TestWithLockTimeout(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+	db.OnQuery = lockResult(false)
+
+	err := psql.WithLock(ctx, "cron:daily", 0, func(ctx context.Context) error {
+		t.Fatal("callback must not run")
+		return nil
+	})
+	assert.ErrorIs(t, err, psql.ErrLockTimeout)
+	assert.Len(t, db.Queries(), 1, "nothing to release")
+}
+
+func TestWithLockInTx(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+	db.OnQuery = lockResult(true)
+
+	err := psql.Tx(ctx, func(ctx context.Context) error {
+		return psql.WithLock(ctx, "cron:daily", 0, func(ctx context.Context) error { return nil })
+	})
+	require.NoError(t, err)
+	_, ok := db.Find("SELECT pg_try_advisory_xact_lock(")
+	assert.True(t, ok)
+	_, ok = db.Find("SELECT pg_advisory_unlock(")
+	assert.False(t, ok, "transaction locks are released on commit")
+}
+
+func TestWithLockMySQL(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineMySQL)
+	db.OnQuery = lockResult(int64(1))
+
+	err := psql.WithLock(ctx, "cron:daily", 0, func(ctx context.Context) error { return nil })
+	require.NoError(t, err)
+	q := db.Queries()
+	require.Len(t, q, 2)
+	assert.Equal(t, "SELECT GET_LOCK(?, ?)", q[0].Query)
+	assert.Equal(t, "SELECT RELEASE_LOCK(?)", q[1].Query)
+}
+
+func TestWithLockTable(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	err := psql.WithLock(ctx, "cron:daily", 0, func(ctx context.Context) error { return nil })
+	require.NoError(t, err)
+	q := db.Queries()
+	require.Len(t, q, 2)
+	assert.True(t, strings.HasPrefix(q[0].Query, `INSERT INTO "psql_locks"`))
+	assert.True(t, strings.HasPrefix(q[1].Query, `DELETE FROM "psql_locks"`))
+}
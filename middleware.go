@@ -0,0 +1,188 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// OpType identifies the kind of typed operation passed to a [Middleware].
+type OpType int
+
+const (
+	OpFetch        OpType = iota // Fetch, Get, FetchOne, Iter
+	OpCount                      // Count
+	OpInsert                     // Insert
+	OpInsertIgnore               // InsertIgnore
+	OpUpdate                     // Update, UpdateFields
+	OpUpdateWhere                // UpdateWhere
+	OpReplace                    // Replace
+	OpUpsert                     // Upsert
+	OpDelete                     // Delete, ForceDelete
+	OpDeleteObj                  // DeleteObj, ForceDeleteObj
+)
+
+func (o OpType) String() string {
+	switch o {
+	case OpFetch:
+		return "fetch"
+	case OpCount:
+		return "count"
+	case OpInsert:
+		return "insert"
+	case OpInsertIgnore:
+		return "insert_ignore"
+	case OpUpdate:
+		return "update"
+	case OpUpdateWhere:
+		return "update_where"
+	case OpReplace:
+		return "replace"
+	case OpUpsert:
+		return "upsert"
+	case OpDelete:
+		return "delete"
+	case OpDeleteObj:
+		return "delete_obj"
+	default:
+		return fmt.Sprintf("OpType(%d)", int(o))
+	}
+}
+
+// IsWrite returns true if the operation modifies data.
+func (o OpType) IsWrite() bool {
+	return o != OpFetch && o != OpCount
+}
+
+// Operation describes a typed operation passing through the [Middleware]
+// chain. Middlewares may modify Where, Values, Options and Objects before
+// calling the next handler; the modified values are used by the operation.
+type Operation struct {
+	Type  OpType
+	Table TableView
+
+	// Objects holds the objects (pointers to the table's type) being written.
+	// For [OpFetch], it is filled with the loaded objects once the next
+	// handler returns, and may be filtered by the middleware (except for Iter).
+	Objects []any
+
+	// Where holds the where clause of set-based operations (Fetch, Count,
+	// Delete, UpdateWhere).
+	Where any
+
+	// Values holds the SET values of [OpUpdateWhere].
+	Values map[string]any
+
+	// Options holds the resolved fetch options, if any.
+	Options *FetchOptions
+
+	// Result is set after a set-based write (Delete, UpdateWhere) ran.
+	Result sql.Result
+
+	single   bool // at most one object is expected (Get, FetchOne)
+	noFanOut bool // results cannot be merged across shards (Iter)
+}
+
+// Handler runs an [Operation].
+type Handler func(ctx context.Context, op *Operation) error
+
+// Middleware wraps typed operations (Insert, Update, Replace, Delete, Fetch,
+// ...) for all tables of a [Backend]. A middleware can inspect or modify the
+// operation, veto it by returning an error without calling next, or act on
+// the result after next returns:
+//
+//	be.Use(func(next psql.Handler) psql.Handler {
+//	    return func(ctx context.Context, op *psql.Operation) error {
+//	        start := time.Now()
+//	        err := next(ctx, op)
+//	        slog.Info("psql op", "op", op.Type, "table", op.Table.TableName(), "took", time.Since(start))
+//	        return err
+//	    }
+//	})
+//
+// Middlewares run in registration order, the first registered being the
+// outermost. Raw queries built with [B] or [Q] do not go through middlewares.
+type Middleware func(next Handler) Handler
+
+// Use registers middlewares on the backend. It should be called during setup,
+// before the backend is used concurrently.
+func (be *Backend) Use(mw ...Middleware) {
+	if be == nil {
+		return
+	}
+	be.extLk.Lock()
+	defer be.extLk.Unlock()
+	// copy so that running chains keep their own slice
+	be.middlewares = append(append([]Middleware(nil), be.middlewares...), mw...)
+}
+
+func (be *Backend) getMiddlewares() []Middleware {
+	if be == nil {
+		return nil
+	}
+	be.extLk.RLock()
+	defer be.extLk.RUnlock()
+	return be.middlewares
+}
+
+// runOp runs fn through the middleware chain of the current backend, within
+// a tracing span if a [Tracer] is configured. Reads are routed to a replica
+// once the middlewares ran.
+//
+// With a [ShardedBackend], the operation is first routed to the right shard,
+// and the middlewares and tracer of that shard are used.
+func (t *TableMeta[T]) runOp(ctx context.Context, op *Operation, fn Handler) error {
+	op.Table = t
+	if err := t.tenantObjects(ctx, op); err != nil {
+		return err
+	}
+	run := func(ctx context.Context, op *Operation) error {
+		h := func(ctx context.Context, op *Operation) error {
+			return t.historyTx(routeRead(ctx, op), op, fn)
+		}
+		mws := GetBackend(ctx).getMiddlewares()
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+		return traceOp(ctx, op, h)
+	}
+	var err error
+	if sb := shardedFromContext(ctx); sb != nil {
+		err = t.runSharded(ctx, sb, op, run)
+	} else if err = t.txShard(ctx, op); err == nil {
+		err = run(ctx, op)
+	}
+	if err == nil {
+		t.identityWritten(ctx, op)
+		t.cacheWritten(ctx, op)
+	}
+	return err
+}
+
+// objectsOf converts typed objects to the []any form used by [Operation].
+func objectsOf[T any](targets []*T) []any {
+	if targets == nil {
+		return nil
+	}
+	res := make([]any, len(targets))
+	for n, v := range targets {
+		res[n] = v
+	}
+	return res
+}
+
+// opTargets converts [Operation.Objects] back to typed objects.
+func opTargets[T any](op *Operation) ([]*T, error) {
+	if op.Objects == nil {
+		return nil, nil
+	}
+	res := make([]*T, len(op.Objects))
+	for n, v := range op.Objects {
+		obj, ok := v.(*T)
+		if !ok {
+			return nil, fmt.Errorf("psql: middleware passed object of type %T, expected %T", v, obj)
+		}
+		res[n] = obj
+	}
+	return res, nil
+}
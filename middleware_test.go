@@ -0,0 +1,116 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareOrderAndInfo(t *testing.T) {
+	_, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+
+	var log []string
+	for _, name := range []string{"outer", "inner"} {
+		be.Use(func(next psql.Handler) psql.Handler {
+			return func(ctx context.Context, op *psql.Operation) error {
+				log = append(log, name+":"+op.Type.String()+":"+op.Table.TableName())
+				return next(ctx, op)
+			}
+		})
+	}
+
+	require.NoError(t, psql.Insert(ctx, &hookedDoc{ID: 1}))
+	assert.Equal(t, []string{"outer:insert:hooked_docs", "inner:insert:hooked_docs"}, log)
+}
+
+func TestMiddlewareVeto(t *testing.T) {
+	db, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+	errDenied := errors.New("denied")
+
+	be.Use(func(next psql.Handler) psql.Handler {
+		return func(ctx context.Context, op *psql.Operation) error {
+			if op.Type == psql.OpDelete {
+				return errDenied
+			}
+			return next(ctx, op)
+		}
+	})
+
+	_, err := psql.Delete[hookedDoc](ctx, map[string]any{"ID": 1})
+	assert.ErrorIs(t, err, errDenied)
+	assert.Empty(t, db.Queries())
+}
+
+func TestMiddlewareModifyWhere(t *testing.T) {
+	db, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{
+			Cols: []string{"ID", "Title"},
+			Data: [][]driver.Value{{"1", "a"}, {"2", "b"}},
+		}, nil
+	}
+
+	be.Use(func(next psql.Handler) psql.Handler {
+		return func(ctx context.Context, op *psql.Operation) error {
+			if op.Type != psql.OpFetch {
+				return next(ctx, op)
+			}
+			op.Where = map[string]any{"Title": "a"}
+			if err := next(ctx, op); err != nil {
+				return err
+			}
+			// post-filter: drop the second row
+			op.Objects = op.Objects[:1]
+			return nil
+		}
+	})
+
+	res, err := psql.Fetch[hookedDoc](ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Contains(t, db.Last().Query, `"Title"=`)
+}
+
+func TestMiddlewareModifyObjects(t *testing.T) {
+	db, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+
+	be.Use(func(next psql.Handler) psql.Handler {
+		return func(ctx context.Context, op *psql.Operation) error {
+			if op.Type.IsWrite() {
+				for _, o := range op.Objects {
+					o.(*hookedDoc).Title = "stamped"
+				}
+			}
+			return next(ctx, op)
+		}
+	})
+
+	require.NoError(t, psql.Insert(ctx, &hookedDoc{ID: 1}))
+	assert.Contains(t, db.Last().Args, "stamped")
+}
+
+func TestMiddlewareModifyRestoreValues(t *testing.T) {
+	db, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+
+	be.Use(func(next psql.Handler) psql.Handler {
+		return func(ctx context.Context, op *psql.Operation) error {
+			if op.Type == psql.OpUpdateWhere {
+				op.Values["Note"] = "restored"
+			}
+			return next(ctx, op)
+		}
+	})
+
+	_, err := psql.Restore[partialOrder](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	q := db.Last()
+	assert.Contains(t, q.Query, `"DeletedAt"=NULL`)
+	assert.Contains(t, q.Query, `"Note"=`)
+	assert.Contains(t, q.Args, "restored")
+}
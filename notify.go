@@ -0,0 +1,209 @@
+package psql
+
+import (
+	"context"
+	"crypto/rand"
+	"log/slog"
+	"time"
+)
+
+// Notification is a message sent with [Notify] and received through
+// [Subscribe].
+type Notification struct {
+	Channel string
+	Payload string
+}
+
+// NotifyProvider is implemented by dialects with native notifications, such
+// as PostgreSQL LISTEN/NOTIFY (which requires access to the driver
+// connection). Without a dialect implementing it, all engines use a polled
+// notification table, and PostgreSQL also sends notifications with pg_notify
+// for native LISTEN clients.
+type NotifyProvider interface {
+	// Notify sends payload on channel. When ctx carries a transaction, the
+	// notification must only be delivered if it commits.
+	Notify(ctx context.Context, channel, payload string) error
+
+	// Listen delivers notifications of channel to out until ctx is done. It
+	// returns ctx.Err() once ctx is done, or any error breaking the
+	// subscription, in which case Listen is called again.
+	Listen(ctx context.Context, be *Backend, channel string, out chan<- *Notification) error
+}
+
+// Settings of the notification table used for engines without a
+// [NotifyProvider]. They should be changed during setup only.
+var (
+	NotifyPollInterval = time.Second      // delay between two polls of the table
+	NotifyLookback     = 10 * time.Second // how late a notification can be committed and still be delivered
+	NotifyRetention    = time.Hour        // notifications older than this are deleted
+)
+
+// notificationRow is a row of the notification table.
+type notificationRow struct {
+	Name      `sql:"psql_notifications"`
+	ID        string    `sql:",key=PRIMARY,type=VARCHAR,size=32"`
+	Channel   string    `sql:",type=VARCHAR,size=255,key=idx_notifications_channel"`
+	Payload   string    `sql:",type=TEXT"`
+	CreatedAt time.Time `sql:",key=idx_notifications_channel"`
+}
+
+// Notify sends payload to the subscribers of channel. When ctx carries a
+// transaction, subscribers only receive the notification if it commits.
+func Notify(ctx context.Context, channel, payload string) error {
+	be := GetBackend(ctx)
+	if np := be.notifyProvider(); np != nil {
+		return np.Notify(ctx, channel, payload)
+	}
+	row := &notificationRow{
+		ID:        rand.Text(),
+		Channel:   channel,
+		Payload:   payload,
+		CreatedAt: time.Now().UTC(),
+	}
+	if be.Engine() != EnginePostgreSQL {
+		return Insert(ctx, row)
+	}
+	send := func(ctx context.Context) error {
+		// also delivered to native LISTEN clients, once committed
+		if _, err := ExecContext(ctx, "SELECT pg_notify($1,$2)", channel, payload); err != nil {
+			return err
+		}
+		return Insert(ctx, row)
+	}
+	if inTx(ctx) {
+		return send(ctx)
+	}
+	return Tx(ctx, send)
+}
+
+// Subscribe returns a Go channel receiving the notifications sent to channel
+// with [Notify] from now on. The Go channel is closed once ctx is done. The
+// subscription does not use the transaction of ctx, if any, and outlives it.
+//
+// On engines without a [NotifyProvider], notifications are stored in the
+// psql_notifications table and polled every [NotifyPollInterval], and
+// delivery is at least once within [NotifyLookback]: a notification
+// committed more than NotifyLookback after it was sent may be missed.
+func Subscribe(ctx context.Context, channel string) (<-chan *Notification, error) {
+	be := GetBackend(ctx)
+	if be == nil {
+		return nil, ErrNotReady
+	}
+	np := be.notifyProvider()
+
+	ctx, cancel := detachTx(ctx)
+	out := make(chan *Notification, 64)
+	if np == nil {
+		go func() {
+			defer cancel()
+			pollNotifications(ctx, channel, time.Now().UTC(), out)
+		}()
+		return out, nil
+	}
+
+	go func() {
+		defer cancel()
+		defer close(out)
+		for {
+			err := np.Listen(ctx, be, channel, out)
+			if ctx.Err() != nil {
+				return
+			}
+			slog.ErrorContext(ctx, "psql: notification listener failed: "+errString(err), "event", "psql:notify:listen_fail", "psql.channel", channel)
+			if !sleepCtx(ctx, NotifyPollInterval) {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// notifyProvider returns the [NotifyProvider] of the backend's dialect, or
+// nil to use the notification table.
+func (be *Backend) notifyProvider() NotifyProvider {
+	if np, ok := be.Engine().dialect().(NotifyProvider); ok {
+		return np
+	}
+	return nil
+}
+
+// detachTx returns a context without the transaction of ctx, cancelled
+// when ctx is done.
+func detachTx(ctx context.Context) (context.Context, context.CancelFunc) {
+	res, cancel := context.WithCancel(escapeAllTx(ctx))
+	stop := context.AfterFunc(ctx, cancel)
+	return res, func() {
+		stop()
+		cancel()
+	}
+}
+
+// pollNotifications delivers notifications of the table to out until ctx is
+// done.
+func pollNotifications(ctx context.Context, channel string, start time.Time, out chan<- *Notification) {
+	defer close(out)
+
+	seen := make(map[string]time.Time)
+	var lastCleanup time.Time
+	for {
+		now := time.Now().UTC()
+		from := now.Add(-NotifyLookback)
+		if from.Before(start) {
+			from = start
+		}
+
+		rows, err := Fetch[notificationRow](ctx,
+			WhereAND{map[string]any{"Channel": channel}, Gte(F("CreatedAt"), from)},
+			Sort(S("CreatedAt", "ASC")),
+		)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "psql: notification poll failed: "+err.Error(), "event", "psql:notify:poll_fail", "psql.channel", channel)
+		}
+		for _, row := range rows {
+			if _, ok := seen[row.ID]; ok {
+				continue
+			}
+			seen[row.ID] = row.CreatedAt
+			select {
+			case out <- &Notification{Channel: row.Channel, Payload: row.Payload}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		for id, t := range seen {
+			if t.Before(from) {
+				delete(seen, id)
+			}
+		}
+
+		if now.Sub(lastCleanup) > time.Minute {
+			lastCleanup = now
+			if _, err := Delete[notificationRow](ctx, Lt(F("CreatedAt"), now.Add(-NotifyRetention))); err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "psql: notification cleanup failed: "+err.Error(), "event", "psql:notify:cleanup_fail")
+			}
+		}
+
+		if !sleepCtx(ctx, NotifyPollInterval) {
+			return
+		}
+	}
+}
+
+// sleepCtx waits for d, and returns false if ctx is done first.
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return "listener stopped"
+	}
+	return err.Error()
+}
@@ -0,0 +1,189 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyTable(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	err := psql.Tx(ctx, func(ctx context.Context) error {
+		return psql.Notify(ctx, "cache", "users:42")
+	})
+	require.NoError(t, err)
+	q := db.Queries()
+	require.Len(t, q, 3)
+	assert.True(t, strings.HasPrefix(q[1].Query, `INSERT INTO "psql_notifications"`))
+	assert.Contains(t, q[1].Args, driver.Value("users:42"))
+	assert.Equal(t, "COMMIT", q[2].Query)
+}
+
+func TestNotifyPostgreSQL(t *testing.T) {
+	defer func(d time.Duration) { psql.NotifyPollInterval = d }(psql.NotifyPollInterval)
+	psql.NotifyPollInterval = time.Millisecond
+
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	err := psql.Tx(ctx, func(ctx context.Context) error {
+		return psql.Notify(ctx, "cache", "users:42")
+	})
+	require.NoError(t, err)
+	q := db.Queries()
+	require.Len(t, q, 4)
+	assert.Equal(t, "SELECT pg_notify($1,$2)", q[1].Query)
+	assert.Equal(t, []driver.Value{"cache", "users:42"}, q[1].Args)
+	assert.True(t, strings.HasPrefix(q[2].Query, `INSERT INTO "psql_notifications"`), "stored for polling subscribers")
+	assert.Equal(t, "COMMIT", q[3].Query)
+
+	// subscribers poll the table
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		if !strings.HasPrefix(q, "SELECT") {
+			return nil, nil
+		}
+		return &fakedb.Rows{
+			Cols: []string{"ID", "Channel", "Payload", "CreatedAt"},
+			Data: [][]driver.Value{{"n1", "cache", "users:42", time.Now().UTC().Format("2006-01-02 15:04:05.999999")}},
+		}, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	ch, err := psql.Subscribe(ctx, "cache")
+	require.NoError(t, err)
+	select {
+	case n := <-ch:
+		assert.Equal(t, "users:42", n.Payload)
+	case <-time.After(time.Second):
+		t.Fatal("no notification received on PostgreSQL")
+	}
+	cancel()
+	for range ch {
+	}
+}
+
+func TestSubscribeInTx(t *testing.T) {
+	defer func(d time.Duration) { psql.NotifyPollInterval = d }(psql.NotifyPollInterval)
+	psql.NotifyPollInterval = time.Millisecond
+
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	var committed atomic.Bool
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		if !strings.HasPrefix(q, "SELECT") || !committed.Load() {
+			return nil, nil
+		}
+		return &fakedb.Rows{
+			Cols: []string{"ID", "Channel", "Payload", "CreatedAt"},
+			Data: [][]driver.Value{{"n1", "cache", "users:42", time.Now().UTC().Format("2006-01-02 15:04:05.999999")}},
+		}, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var ch <-chan *psql.Notification
+	require.NoError(t, psql.Tx(ctx, func(ctx context.Context) error {
+		var err error
+		ch, err = psql.Subscribe(ctx, "cache")
+		return err
+	}))
+	committed.Store(true)
+
+	// polls keep working once the transaction is done
+	select {
+	case n := <-ch:
+		assert.Equal(t, "users:42", n.Payload)
+	case <-time.After(time.Second):
+		t.Fatal("no notification after the transaction ended")
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestSubscribePolling(t *testing.T) {
+	defer func(d time.Duration) { psql.NotifyPollInterval = d }(psql.NotifyPollInterval)
+	psql.NotifyPollInterval = time.Millisecond
+
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		if !strings.HasPrefix(q, "SELECT") {
+			return nil, nil
+		}
+		return &fakedb.Rows{
+			Cols: []string{"ID", "Channel", "Payload", "CreatedAt"},
+			Data: [][]driver.Value{{"n1", "cache", "users:42", time.Now().UTC().Format("2006-01-02 15:04:05.999999")}},
+		}, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	ch, err := psql.Subscribe(ctx, "cache")
+	require.NoError(t, err)
+
+	n := <-ch
+	assert.Equal(t, &psql.Notification{Channel: "cache", Payload: "users:42"}, n)
+
+	// the same row is returned by every poll but only delivered once
+	select {
+	case n := <-ch:
+		t.Fatalf("unexpected duplicate %v", n)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	sel, ok := db.Find("SELECT")
+	require.True(t, ok)
+	assert.Contains(t, sel.Query, `"Channel"=`)
+	_, ok = db.Find(`DELETE FROM "psql_notifications"`)
+	assert.True(t, ok, "old notifications are cleaned up")
+
+	cancel()
+	for range ch {
+	}
+}
+
+// notifyDialect provides native notifications.
+type notifyDialect struct {
+	testPgDialect
+	sent chan *psql.Notification
+}
+
+func (d *notifyDialect) Notify(ctx context.Context, channel, payload string) error {
+	d.sent <- &psql.Notification{Channel: channel, Payload: payload}
+	return nil
+}
+
+func (d *notifyDialect) Listen(ctx context.Context, be *psql.Backend, channel string, out chan<- *psql.Notification) error {
+	for {
+		select {
+		case n := <-d.sent:
+			out <- n
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestSubscribeProvider(t *testing.T) {
+	engine := psql.Engine(101)
+	psql.RegisterDialect(engine, &notifyDialect{sent: make(chan *psql.Notification, 1)})
+	db, ctx := fakedb.New(t, engine)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch, err := psql.Subscribe(ctx, "cache")
+	require.NoError(t, err)
+
+	require.NoError(t, psql.Notify(ctx, "cache", "hello"))
+	assert.Equal(t, "hello", (<-ch).Payload)
+	assert.Empty(t, db.Queries(), "the notification table is not used")
+
+	cancel()
+	for range ch {
+	}
+}
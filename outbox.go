@@ -0,0 +1,208 @@
+package psql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// OutboxStatus is the processing state of an [OutboxMessage].
+type OutboxStatus string
+
+const (
+	OutboxPending OutboxStatus = "pending" // waiting to be published
+	OutboxDone    OutboxStatus = "done"    // published successfully
+	OutboxDead    OutboxStatus = "dead"    // dead-lettered after too many failed attempts
+)
+
+// OutboxMessage is a message stored in the outbox table by [Outbox] and
+// published by an [OutboxRelay].
+type OutboxMessage struct {
+	Name        `sql:"psql_outbox"`
+	ID          string       `sql:",key=PRIMARY,type=VARCHAR,size=32"`
+	Topic       string       `sql:",type=VARCHAR,size=255"`
+	Payload     []byte       // JSON encoded, unless a []byte was passed to Outbox
+	Status      OutboxStatus `sql:",type=VARCHAR,size=16,key=idx_outbox_status"`
+	Attempts    int          // failed publish attempts
+	LastError   *string      `sql:",type=TEXT"`
+	AvailableAt time.Time    `sql:",key=idx_outbox_status"` // not published before this time
+	CreatedAt   time.Time
+	ProcessedAt *time.Time // set when done or dead-lettered
+}
+
+// Outbox stores a message for topic in the outbox table, in the transaction
+// of ctx: the message is only published by an [OutboxRelay] if the
+// transaction commits. payload is stored as is if it is a []byte or
+// json.RawMessage, and JSON encoded otherwise.
+//
+// Without a transaction in ctx, the message is stored immediately.
+func Outbox(ctx context.Context, topic string, payload any) error {
+	var data []byte
+	switch v := payload.(type) {
+	case []byte:
+		data = v
+	case json.RawMessage:
+		data = v
+	default:
+		var err error
+		data, err = json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	msg := &OutboxMessage{
+		ID:          rand.Text(),
+		Topic:       topic,
+		Payload:     data,
+		Status:      OutboxPending,
+		AvailableAt: now,
+		CreatedAt:   now,
+	}
+	return Insert(ctx, msg)
+}
+
+// OutboxPublisher publishes a message, typically to a message broker. A
+// returned error causes the message to be retried later.
+type OutboxPublisher func(ctx context.Context, msg *OutboxMessage) error
+
+// OutboxRelay publishes the messages stored with [Outbox]. Each batch is
+// claimed in a transaction with [FetchLockSkipLocked], so that several relays
+// can run concurrently on MySQL and PostgreSQL. SQLite has no row locks: the
+// write lock of the database is taken at the start of the transaction
+// instead, so relays wait for each other rather than claiming the same
+// messages.
+//
+// Published messages are marked [OutboxDone]. Failed messages are retried
+// with exponential backoff, and marked [OutboxDead] once MaxAttempts is
+// reached.
+type OutboxRelay struct {
+	Publish      OutboxPublisher
+	Topics       []string      // only relay these topics if not empty
+	BatchSize    int           // messages claimed at once, defaults to 100
+	MaxAttempts  int           // attempts before dead-lettering, defaults to 10
+	PollInterval time.Duration // wait when no message is available, defaults to 1s
+
+	// Backoff returns the delay before retrying a message that failed
+	// attempts times. Defaults to 1s doubled after each attempt, up to 1h.
+	Backoff func(attempts int) time.Duration
+}
+
+// Run relays messages until ctx is cancelled, then returns ctx.Err().
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	for {
+		n, err := r.ProcessBatch(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "psql: outbox relay failed: "+err.Error(), "event", "psql:outbox:relay_fail")
+		}
+		if err == nil && n >= r.batchSize() {
+			// there may be more waiting
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		timer := time.NewTimer(r.pollInterval())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// ProcessBatch claims a batch of messages available for publishing, publishes
+// them and records the outcome. It returns the number of messages claimed.
+func (r *OutboxRelay) ProcessBatch(ctx context.Context) (int, error) {
+	var n int
+	err := Tx(ctx, func(txCtx context.Context) error {
+		if err := LockForWrite[OutboxMessage](txCtx); err != nil {
+			return err
+		}
+
+		where := WhereAND{
+			map[string]any{"Status": string(OutboxPending)},
+			Lte(F("AvailableAt"), time.Now().UTC()),
+		}
+		if len(r.Topics) > 0 {
+			where = append(where, map[string]any{"Topic": r.Topics})
+		}
+		list, err := Fetch[OutboxMessage](txCtx, where,
+			Sort(S("AvailableAt", "ASC")),
+			Limit(r.batchSize()),
+			FetchLockSkipLocked,
+		)
+		if err != nil {
+			return err
+		}
+		n = len(list)
+
+		for _, msg := range list {
+			r.handle(ctx, msg)
+			if err := Update(txCtx, msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// handle publishes msg and updates it according to the result.
+func (r *OutboxRelay) handle(ctx context.Context, msg *OutboxMessage) {
+	err := r.Publish(ctx, msg)
+	now := time.Now().UTC()
+	if err == nil {
+		msg.Status = OutboxDone
+		msg.ProcessedAt = &now
+		return
+	}
+
+	msg.Attempts += 1
+	errStr := err.Error()
+	msg.LastError = &errStr
+	if msg.Attempts >= r.maxAttempts() {
+		msg.Status = OutboxDead
+		msg.ProcessedAt = &now
+		slog.WarnContext(ctx, "psql: outbox message dead-lettered: "+errStr, "event", "psql:outbox:dead_letter", "psql.outbox.id", msg.ID, "psql.outbox.topic", msg.Topic)
+		return
+	}
+	msg.AvailableAt = now.Add(r.backoff(msg.Attempts))
+}
+
+func (r *OutboxRelay) batchSize() int {
+	if r.BatchSize > 0 {
+		return r.BatchSize
+	}
+	return 100
+}
+
+func (r *OutboxRelay) maxAttempts() int {
+	if r.MaxAttempts > 0 {
+		return r.MaxAttempts
+	}
+	return 10
+}
+
+func (r *OutboxRelay) pollInterval() time.Duration {
+	if r.PollInterval > 0 {
+		return r.PollInterval
+	}
+	return time.Second
+}
+
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	if r.Backoff != nil {
+		return r.Backoff(attempts)
+	}
+	d := time.Second
+	for i := 1; i < attempts && d < time.Hour; i++ {
+		d *= 2
+	}
+	return min(d, time.Hour)
+}
@@ -0,0 +1,121 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxInsertsInTx(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	err := psql.Tx(ctx, func(ctx context.Context) error {
+		return psql.Outbox(ctx, "order.created", map[string]any{"id": 42})
+	})
+	require.NoError(t, err)
+
+	q, ok := db.Find(`INSERT INTO "psql_outbox"`)
+	require.True(t, ok)
+	assert.Contains(t, q.Args, driver.Value("order.created"))
+	assert.Contains(t, q.Args, driver.Value([]byte(`{"id":42}`)))
+	assert.Contains(t, q.Args, driver.Value("pending"))
+	assert.Equal(t, "COMMIT", db.Last().Query)
+}
+
+// outboxRows returns a claimable outbox row for the fake database.
+func outboxRows(attempts string) func(q string, args []driver.Value) (*fakedb.Rows, error) {
+	return func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		if !strings.HasPrefix(q, "SELECT") {
+			return nil, nil
+		}
+		return &fakedb.Rows{
+			Cols: []string{"ID", "Topic", "Payload", "Status", "Attempts", "LastError", "AvailableAt", "CreatedAt", "ProcessedAt"},
+			Data: [][]driver.Value{{"m1", "t", []byte("{}"), "pending", attempts, nil, "2026-01-01 00:00:00", "2026-01-01 00:00:00", nil}},
+		}, nil
+	}
+}
+
+func TestOutboxRelayPublishes(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+	db.OnQuery = outboxRows("0")
+
+	var got []string
+	r := &psql.OutboxRelay{Publish: func(ctx context.Context, msg *psql.OutboxMessage) error {
+		got = append(got, msg.ID)
+		return nil
+	}}
+	n, err := r.ProcessBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"m1"}, got)
+
+	sel, ok := db.Find("SELECT")
+	require.True(t, ok)
+	assert.Contains(t, sel.Query, "FOR UPDATE SKIP LOCKED")
+
+	upd, ok := db.Find(`UPDATE "psql_outbox"`)
+	require.True(t, ok)
+	assert.Contains(t, upd.Args, driver.Value("done"))
+	assert.Equal(t, "COMMIT", db.Last().Query)
+}
+
+// outboxUpdate returns the update of a claimed message, skipping the SQLite
+// write lock statement.
+func outboxUpdate(db *fakedb.DB) (fakedb.Query, bool) {
+	for _, q := range db.Queries() {
+		if strings.HasPrefix(q.Query, `UPDATE "psql_outbox"`) && len(q.Args) > 0 {
+			return q, true
+		}
+	}
+	return fakedb.Query{}, false
+}
+
+func TestOutboxRelayRetriesAndDeadLetters(t *testing.T) {
+	fail := func(ctx context.Context, msg *psql.OutboxMessage) error {
+		return errors.New("broker down")
+	}
+
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = outboxRows("0")
+	r := &psql.OutboxRelay{Publish: fail, MaxAttempts: 3, Backoff: func(int) time.Duration { return time.Minute }}
+	_, err := r.ProcessBatch(ctx)
+	require.NoError(t, err)
+	upd, ok := outboxUpdate(db)
+	require.True(t, ok)
+	assert.Contains(t, upd.Args, driver.Value("broker down"))
+	assert.NotContains(t, upd.Args, driver.Value("dead"))
+	sel, _ := db.Find("SELECT")
+	assert.NotContains(t, sel.Query, "FOR UPDATE", "SQLite has no row locks")
+
+	db, ctx = fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = outboxRows("2")
+	_, err = r.ProcessBatch(ctx)
+	require.NoError(t, err)
+	upd, ok = outboxUpdate(db)
+	require.True(t, ok)
+	assert.Contains(t, upd.Args, driver.Value("dead"))
+}
+
+func TestOutboxRelaySQLiteLock(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = outboxRows("0")
+
+	r := &psql.OutboxRelay{Publish: func(ctx context.Context, msg *psql.OutboxMessage) error {
+		return nil
+	}}
+	_, err := r.ProcessBatch(ctx)
+	require.NoError(t, err)
+
+	q := db.Queries()
+	require.GreaterOrEqual(t, len(q), 3)
+	assert.Equal(t, "BEGIN", q[0].Query)
+	assert.Equal(t, `UPDATE "psql_outbox" SET "ID"="ID" WHERE 1=0`, q[1].Query, "the write lock is taken before reading")
+}
@@ -98,7 +98,11 @@ func (q *SQLQuery) Each(ctx context.Context, cb func(*sql.Rows) error) error {
 
 // Exec simply executes the query and returns any error that could have happened
 func (q *SQLQuery) Exec(ctx context.Context) error {
-	_, err := GetBackend(ctx).DB().Exec(q.Query, q.Args...)
+	// runs on the backend's database, outside of any transaction in ctx
+	be := GetBackend(ctx)
+	_, err := intercept(ctx, QueryExec, q.Query, q.Args, func(_ context.Context, query string, args ...any) (sql.Result, error) {
+		return be.DB().Exec(query, args...)
+	}, resultRowsAffected)
 	return err
 }
 
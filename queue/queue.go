@@ -0,0 +1,252 @@
+// Package queue implements a job queue stored in a psql table, using
+// SELECT ... FOR UPDATE SKIP LOCKED so that any number of workers can claim
+// jobs concurrently.
+//
+//	type SendEmail struct {
+//	    To, Subject string
+//	}
+//
+//	queue.Enqueue(ctx, SendEmail{To: "a@example.com"}, queue.Delay(time.Minute))
+//
+//	jobs, err := queue.Claim[SendEmail](ctx, 10, 5*time.Minute)
+//	for _, job := range jobs {
+//	    if err := send(job.Payload); err != nil {
+//	        queue.Fail(ctx, job, err)
+//	        continue
+//	    }
+//	    queue.Complete(ctx, job)
+//	}
+//
+// Each payload type is a separate queue. Jobs of all queues are stored in the
+// psql_jobs table, with their payload JSON encoded.
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/portablesql/psql"
+)
+
+// Status is the state of a [Job].
+type Status string
+
+const (
+	Pending Status = "pending" // waiting for its RunAt time
+	Running Status = "running" // claimed by a worker until LeaseUntil
+	Done    Status = "done"    // completed
+	Failed  Status = "failed"  // failed MaxAttempts times
+)
+
+// Job is a queued job carrying a payload of type T.
+type Job[T any] struct {
+	psql.Name   `sql:"psql_jobs"`
+	ID          string     `sql:",key=PRIMARY,type=VARCHAR,size=32"`
+	Queue       string     `sql:",type=VARCHAR,size=255,key=idx_jobs_claim"`
+	Status      Status     `sql:",type=VARCHAR,size=16,key=idx_jobs_claim"`
+	Priority    int        `sql:",key=idx_jobs_claim"` // higher runs first
+	RunAt       time.Time  `sql:",key=idx_jobs_claim"` // not claimed before this time
+	Payload     T          `sql:",format=json,type=TEXT"`
+	Attempts    int        // number of times the job was claimed
+	MaxAttempts int        // attempts before the job is marked Failed
+	LeaseUntil  *time.Time // while Running, the job is claimed again after this time
+	LastError   *string    `sql:",type=TEXT"`
+	Version     int64      `sql:",version"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Option configures a job created by [Enqueue].
+type Option func(*options)
+
+type options struct {
+	runAt       time.Time
+	priority    int
+	maxAttempts int
+}
+
+// RunAt schedules the job to run at t.
+func RunAt(t time.Time) Option {
+	return func(o *options) {
+		o.runAt = t
+	}
+}
+
+// Delay schedules the job to run after d.
+func Delay(d time.Duration) Option {
+	return func(o *options) {
+		o.runAt = time.Now().Add(d)
+	}
+}
+
+// Priority sets the priority of the job. Jobs with a higher priority are
+// claimed first; the default is 0.
+func Priority(p int) Option {
+	return func(o *options) {
+		o.priority = p
+	}
+}
+
+// MaxAttempts sets how many times the job can be claimed before being marked
+// [Failed]. The default is [DefaultMaxAttempts].
+func MaxAttempts(n int) Option {
+	return func(o *options) {
+		o.maxAttempts = n
+	}
+}
+
+// DefaultMaxAttempts is the number of attempts of jobs enqueued without the
+// [MaxAttempts] option.
+var DefaultMaxAttempts = 10
+
+// Backoff returns the delay before a job that failed attempts times runs
+// again. It can be replaced during setup.
+var Backoff = func(attempts int) time.Duration {
+	d := time.Second
+	for i := 1; i < attempts && d < time.Hour; i++ {
+		d *= 2
+	}
+	return min(d, time.Hour)
+}
+
+// ErrLeaseLost is returned by [Complete] and [Fail] when the job was claimed
+// again by another worker after its lease expired.
+var ErrLeaseLost = errors.New("queue: job lease expired and was claimed again")
+
+// Name returns the name of the queue for payloads of type T.
+func Name[T any]() string {
+	typ := reflect.TypeFor[T]()
+	if typ.PkgPath() == "" {
+		return typ.String()
+	}
+	return typ.PkgPath() + "." + typ.Name()
+}
+
+// Enqueue adds a job with the given payload to the queue of T. When ctx
+// carries a transaction, the job is only visible once it commits.
+func Enqueue[T any](ctx context.Context, payload T, opts ...Option) (*Job[T], error) {
+	o := &options{maxAttempts: DefaultMaxAttempts}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.runAt.IsZero() {
+		o.runAt = time.Now()
+	}
+
+	job := &Job[T]{
+		ID:          rand.Text(),
+		Queue:       Name[T](),
+		Status:      Pending,
+		Priority:    o.priority,
+		RunAt:       o.runAt.UTC(),
+		Payload:     payload,
+		MaxAttempts: o.maxAttempts,
+	}
+	if err := psql.Insert(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Claim claims up to n jobs of the queue of T, by priority then RunAt. Claimed
+// jobs are Running and invisible to other workers for the lease duration, after
+// which they can be claimed again unless [Complete] or [Fail] was called.
+// Jobs whose lease expired on their last attempt are marked [Failed].
+//
+// Jobs are claimed with FOR UPDATE SKIP LOCKED in a transaction, or in a
+// savepoint of the transaction of ctx if it has one, in which case the jobs
+// stay locked until that transaction ends. On SQLite, which has no row locks,
+// the database write lock is taken before reading with [psql.LockForWrite],
+// so that workers claim jobs one after the other.
+func Claim[T any](ctx context.Context, n int, lease time.Duration) ([]*Job[T], error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	var res []*Job[T]
+	err := psql.Tx(ctx, func(ctx context.Context) error {
+		if err := psql.LockForWrite[Job[T]](ctx); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		where := psql.WhereAND{
+			map[string]any{"Queue": Name[T]()},
+			psql.WhereOR{
+				psql.WhereAND{map[string]any{"Status": string(Pending)}, psql.Lte(psql.F("RunAt"), now)},
+				psql.WhereAND{map[string]any{"Status": string(Running)}, psql.Lte(psql.F("LeaseUntil"), now)},
+			},
+		}
+		jobs, err := psql.Fetch[Job[T]](ctx, where,
+			psql.Sort(psql.S("Priority", "DESC"), psql.S("RunAt", "ASC")),
+			psql.Limit(n),
+			psql.FetchLockSkipLocked,
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, job := range jobs {
+			if job.Attempts >= job.MaxAttempts {
+				// the lease of the last attempt expired
+				job.Status = Failed
+				job.LeaseUntil = nil
+				if job.LastError == nil {
+					msg := "lease expired"
+					job.LastError = &msg
+				}
+			} else {
+				until := now.Add(lease)
+				job.Status = Running
+				job.Attempts += 1
+				job.LeaseUntil = &until
+			}
+			if err := psql.Update(ctx, job); err != nil {
+				return err
+			}
+			if job.Status == Running {
+				res = append(res, job)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Complete marks a claimed job as [Done].
+func Complete[T any](ctx context.Context, job *Job[T]) error {
+	job.Status = Done
+	job.LeaseUntil = nil
+	return update(ctx, job)
+}
+
+// Fail records a failed attempt of a claimed job. The job runs again after
+// [Backoff], or is marked [Failed] once MaxAttempts is reached.
+func Fail[T any](ctx context.Context, job *Job[T], cause error) error {
+	if cause != nil {
+		msg := cause.Error()
+		job.LastError = &msg
+	}
+	job.LeaseUntil = nil
+	if job.Attempts >= job.MaxAttempts {
+		job.Status = Failed
+	} else {
+		job.Status = Pending
+		job.RunAt = time.Now().UTC().Add(Backoff(job.Attempts))
+	}
+	return update(ctx, job)
+}
+
+func update[T any](ctx context.Context, job *Job[T]) error {
+	err := psql.Update(ctx, job)
+	if errors.Is(err, psql.ErrStaleObject) {
+		return fmt.Errorf("%w: job %s", ErrLeaseLost, job.ID)
+	}
+	return err
+}
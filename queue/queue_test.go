@@ -0,0 +1,122 @@
+package queue_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/portablesql/psql/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type emailJob struct {
+	To string
+}
+
+// jobRows returns a claimable job row for the fake database.
+func jobRows(status, attempts, maxAttempts string) func(q string, args []driver.Value) (*fakedb.Rows, error) {
+	return func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		if !strings.HasPrefix(q, "SELECT") {
+			return nil, nil
+		}
+		return &fakedb.Rows{
+			Cols: []string{"ID", "Queue", "Status", "Priority", "RunAt", "Payload", "Attempts", "MaxAttempts", "LeaseUntil", "LastError", "Version", "CreatedAt", "UpdatedAt"},
+			Data: [][]driver.Value{{"j1", queue.Name[emailJob](), status, "0", "2026-01-01 00:00:00", `{"To":"a@example.com"}`, attempts, maxAttempts, nil, nil, "1", "2026-01-01 00:00:00", "2026-01-01 00:00:00"}},
+		}, nil
+	}
+}
+
+func TestQueueEnqueue(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	job, err := queue.Enqueue(ctx, emailJob{To: "a@example.com"}, queue.Priority(5), queue.Delay(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, queue.Pending, job.Status)
+	assert.Equal(t, "github.com/portablesql/psql/queue_test.emailJob", job.Queue)
+	assert.True(t, job.RunAt.After(time.Now().Add(59*time.Minute)))
+
+	q := db.Last()
+	assert.True(t, strings.HasPrefix(q.Query, `INSERT INTO "psql_jobs"`))
+	assert.Contains(t, q.Args, driver.Value(`{"To":"a@example.com"}`))
+}
+
+func TestQueueClaim(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+	db.OnQuery = jobRows("pending", "0", "3")
+
+	jobs, err := queue.Claim[emailJob](ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	job := jobs[0]
+	assert.Equal(t, "a@example.com", job.Payload.To)
+	assert.Equal(t, queue.Running, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	require.NotNil(t, job.LeaseUntil)
+
+	sel, ok := db.Find("SELECT")
+	require.True(t, ok)
+	assert.Contains(t, sel.Query, `ORDER BY "Priority" DESC,"RunAt" ASC`)
+	assert.Contains(t, sel.Query, "FOR UPDATE SKIP LOCKED")
+	_, ok = db.Find(`UPDATE "psql_jobs"`)
+	assert.True(t, ok)
+	assert.Equal(t, "COMMIT", db.Last().Query)
+
+	require.NoError(t, queue.Fail(ctx, job, errors.New("smtp down")))
+	assert.Equal(t, queue.Pending, job.Status)
+	assert.True(t, job.RunAt.After(time.Now()))
+	assert.Nil(t, job.LeaseUntil)
+
+	require.NoError(t, queue.Complete(ctx, job))
+	assert.Equal(t, queue.Done, job.Status)
+}
+
+func TestQueueClaimExpiredLastAttempt(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+	db.OnQuery = jobRows("running", "3", "3")
+
+	jobs, err := queue.Claim[emailJob](ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+	upd, ok := db.Find(`UPDATE "psql_jobs"`)
+	require.True(t, ok)
+	assert.Contains(t, upd.Args, driver.Value("failed"))
+}
+
+func TestQueueClaimSQLite(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = jobRows("pending", "0", "3")
+
+	_, err := queue.Claim[emailJob](ctx, 1, time.Minute)
+	require.NoError(t, err)
+	q := db.Queries()
+	require.Greater(t, len(q), 2)
+	assert.Equal(t, "BEGIN", q[0].Query)
+	assert.True(t, strings.HasPrefix(q[1].Query, `UPDATE "psql_jobs" SET "ID"="ID"`), "write lock is taken first")
+	assert.True(t, q[1].InTx, "write lock is taken by the claiming transaction")
+	assert.NotContains(t, q[2].Query, "FOR UPDATE")
+}
+
+func TestQueueLeaseLost(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+	db.OnExec = func(q string, args []driver.Value) (driver.Result, error) {
+		return driver.RowsAffected(0), nil
+	}
+
+	job := &queue.Job[emailJob]{ID: "j1", Status: queue.Running, Attempts: 1, MaxAttempts: 3}
+	assert.ErrorIs(t, queue.Complete(ctx, job), queue.ErrLeaseLost)
+}
+
+func TestQueueClaimInTx(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+	err := psql.Tx(ctx, func(ctx context.Context) error {
+		_, err := queue.Claim[emailJob](ctx, 1, time.Minute)
+		return err
+	})
+	require.NoError(t, err)
+}
@@ -10,7 +10,8 @@ import (
 // Replace performs an upsert operation: inserts the record if it doesn't exist, or
 // replaces it if a conflicting key exists. On MySQL this uses REPLACE INTO, on
 // PostgreSQL it uses INSERT ... ON CONFLICT DO UPDATE, on SQLite INSERT OR REPLACE.
-// Fires [BeforeSaveHook] and [AfterSaveHook] if implemented.
+// Fires [BeforeSaveHook] and [AfterSaveHook] if implemented. CreatedAt is set if
+// zero, and UpdatedAt is always refreshed.
 func Replace[T any](ctx context.Context, target ...*T) error {
 	if len(target) == 0 {
 		return nil
@@ -20,6 +21,19 @@ func Replace[T any](ctx context.Context, target ...*T) error {
 }
 
 func (t *TableMeta[T]) Replace(ctx context.Context, targets ...*T) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	return t.runOp(ctx, &Operation{Type: OpReplace, Objects: objectsOf(targets)}, func(ctx context.Context, op *Operation) error {
+		targets, err := opTargets[T](op)
+		if err != nil {
+			return err
+		}
+		return t.replace(ctx, targets...)
+	})
+}
+
+func (t *TableMeta[T]) replace(ctx context.Context, targets ...*T) error {
 	if t == nil {
 		return ErrNotReady
 	}
@@ -41,14 +55,25 @@ func (t *TableMeta[T]) Replace(ctx context.Context, targets ...*T) error {
 		useReturning = rr.SupportsReturning()
 	}
 
+	// column sets a replaced row may conflict on, for history
+	var conflicts [][]string
 	if ur, ok := d.(UpsertRenderer); ok {
 		req = ur.ReplaceSQL(tableName, t.fldStr, ph, t.mainKey, t.fields)
+		if t.mainKey != nil {
+			conflicts = append(conflicts, t.mainKey.Fields)
+		}
 	} else {
 		// Generic fallback: MySQL-like REPLACE INTO
 		if t.mainKey == nil {
 			return errors.New("cannot use Replace without a primary key")
 		}
 		req = "REPLACE INTO " + QuoteName(tableName) + " (" + t.fldStr + ") VALUES (" + ph + ")"
+		// REPLACE deletes the rows conflicting on any unique key
+		for _, k := range t.keys {
+			if k.Typ == KeyPrimary || k.Typ == KeyUnique {
+				conflicts = append(conflicts, k.Fields)
+			}
+		}
 	}
 
 	if useReturning {
@@ -70,6 +95,12 @@ func (t *TableMeta[T]) Replace(ctx context.Context, targets ...*T) error {
 		}
 
 		val := reflect.ValueOf(target).Elem()
+		t.touchCreate(be, val, true)
+
+		before, err := t.historyConflicts(ctx, val, conflicts)
+		if err != nil {
+			return err
+		}
 
 		params := make([]any, len(t.fields))
 
@@ -85,7 +116,7 @@ func (t *TableMeta[T]) Replace(ctx context.Context, targets ...*T) error {
 		}
 
 		if useReturning {
-			rows, err := stmt.QueryContext(ctx, params...)
+			rows, err := stmtQueryContext(ctx, stmt, req, params...)
 			if err != nil {
 				slog.ErrorContext(ctx, req+"\n"+err.Error()+"\n"+debugStack(), "event", "psql:replace:run_fail", "psql.table", tableName)
 				return &Error{Query: req, Err: err}
@@ -98,13 +129,19 @@ func (t *TableMeta[T]) Replace(ctx context.Context, targets ...*T) error {
 			}
 			rows.Close()
 		} else {
-			_, err := stmt.ExecContext(ctx, params...)
+			_, err := stmtExecContext(ctx, stmt, req, params...)
 			if err != nil {
 				slog.ErrorContext(ctx, req+"\n"+err.Error()+"\n"+debugStack(), "event", "psql:replace:run_fail", "psql.table", tableName)
 				return &Error{Query: req, Err: err}
 			}
 		}
 
+		if t.history {
+			if err := t.historyReplaced(ctx, val, before); err != nil {
+				return err
+			}
+		}
+
 		if h, ok := any(target).(AfterSaveHook); ok {
 			if err := h.AfterSave(ctx); err != nil {
 				return err
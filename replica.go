@@ -0,0 +1,102 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+)
+
+// ReplicaPolicy picks the replica used for a read operation. replicas is never
+// empty. Returning nil sends the read to the primary.
+type ReplicaPolicy interface {
+	PickReplica(ctx context.Context, replicas []*sql.DB) *sql.DB
+}
+
+// ReplicaPolicyFunc adapts a function to the [ReplicaPolicy] interface.
+type ReplicaPolicyFunc func(ctx context.Context, replicas []*sql.DB) *sql.DB
+
+func (f ReplicaPolicyFunc) PickReplica(ctx context.Context, replicas []*sql.DB) *sql.DB {
+	return f(ctx, replicas)
+}
+
+// RoundRobin returns a [ReplicaPolicy] cycling through replicas. This is the
+// default policy.
+func RoundRobin() ReplicaPolicy {
+	var n atomic.Uint64
+	return ReplicaPolicyFunc(func(ctx context.Context, replicas []*sql.DB) *sql.DB {
+		return replicas[(n.Add(1)-1)%uint64(len(replicas))]
+	})
+}
+
+// WithReplicas adds read replicas to the backend. Reads from typed operations
+// (Fetch, Get, FetchOne, Count, Iter, ...) are then sent to a replica chosen
+// by the [ReplicaPolicy], while writes, locking reads ([FetchLock]) and
+// everything inside a transaction go to the primary. Use [UsePrimary] to read
+// from the primary, e.g. right after a write.
+func WithReplicas(dbs ...*sql.DB) BackendOption {
+	return func(b *Backend) {
+		b.replicas = append(b.replicas, dbs...)
+		if b.replicaPolicy == nil {
+			b.replicaPolicy = RoundRobin()
+		}
+	}
+}
+
+// WithReplicaPolicy sets the [ReplicaPolicy] used to pick a replica.
+func WithReplicaPolicy(p ReplicaPolicy) BackendOption {
+	return func(b *Backend) {
+		b.replicaPolicy = p
+	}
+}
+
+// Replicas returns the read replicas configured on the backend.
+func (be *Backend) Replicas() []*sql.DB {
+	if be == nil {
+		return nil
+	}
+	return be.replicas
+}
+
+// UsePrimary returns a context for which all reads are sent to the primary
+// database, even if the backend has replicas. This is useful for
+// read-after-write paths that cannot tolerate replication lag.
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ctxUsePrimary, true)
+}
+
+// replicaRoute is attached to the context of a read operation routed to a
+// replica. Only queries returning rows use the replica: statements and
+// transactions started from such a context (e.g. in an AfterScan hook) still
+// go to the primary.
+type replicaRoute struct {
+	db *sql.DB
+}
+
+// routeRead returns a context sending the reads of op to a replica, if
+// possible.
+func routeRead(ctx context.Context, op *Operation) context.Context {
+	if op.Type != OpFetch && op.Type != OpCount {
+		return ctx
+	}
+	if op.Options != nil && op.Options.Lock {
+		return ctx
+	}
+	switch ctx.Value(ctxDataObj).(type) {
+	case nil, *Backend:
+	default:
+		// transaction, connection or explicit DB: keep it
+		return ctx
+	}
+	if v, _ := ctx.Value(ctxUsePrimary).(bool); v {
+		return ctx
+	}
+	be := GetBackend(ctx)
+	if be == nil || len(be.replicas) == 0 || be.replicaPolicy == nil {
+		return ctx
+	}
+	db := be.replicaPolicy.PickReplica(ctx, be.replicas)
+	if db == nil {
+		return ctx
+	}
+	return &ctxValueObj{ctx, &replicaRoute{db}}
+}
@@ -0,0 +1,80 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newReplicaBackend(t *testing.T) (primary, replica *fakedb.DB, ctx context.Context) {
+	t.Helper()
+	primary, replica = &fakedb.DB{}, &fakedb.DB{}
+	pdb, rdb := sql.OpenDB(primary), sql.OpenDB(replica)
+	t.Cleanup(func() { pdb.Close(); rdb.Close() })
+	be := psql.NewBackend(psql.EngineSQLite, pdb, psql.WithReplicas(rdb))
+	return primary, replica, be.Plug(context.Background())
+}
+
+func TestReplicaReads(t *testing.T) {
+	primary, replica, ctx := newReplicaBackend(t)
+	replica.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		if strings.Contains(q, "COUNT(1)") {
+			return &fakedb.Rows{Cols: []string{"COUNT(1)"}, Data: [][]driver.Value{{int64(4)}}}, nil
+		}
+		return nil, nil
+	}
+
+	_, err := psql.Fetch[hookedDoc](ctx, nil)
+	require.NoError(t, err)
+	_, err = psql.Count[hookedDoc](ctx, nil)
+	require.NoError(t, err)
+
+	assert.Len(t, replica.Queries(), 2)
+	assert.Empty(t, primary.Queries())
+}
+
+func TestReplicaWritesAndLocks(t *testing.T) {
+	primary, replica, ctx := newReplicaBackend(t)
+
+	require.NoError(t, psql.Insert(ctx, &hookedDoc{ID: 1}))
+	_, err := psql.Fetch[hookedDoc](ctx, nil, psql.FetchLock)
+	require.NoError(t, err)
+	_, err = psql.Fetch[hookedDoc](psql.UsePrimary(ctx), nil)
+	require.NoError(t, err)
+
+	assert.Empty(t, replica.Queries())
+	assert.Len(t, primary.Queries(), 3)
+}
+
+func TestReplicaReload(t *testing.T) {
+	primary, replica, ctx := newReplicaBackend(t)
+	primary.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{Cols: []string{"ID", "Title"}, Data: [][]driver.Value{{int64(1), "fresh"}}}, nil
+	}
+
+	doc := &hookedDoc{ID: 1}
+	require.NoError(t, psql.Reload(ctx, doc))
+	assert.Equal(t, "fresh", doc.Title)
+	assert.Empty(t, replica.Queries(), "reloads read the primary")
+}
+
+func TestReplicaTx(t *testing.T) {
+	primary, replica, ctx := newReplicaBackend(t)
+
+	err := psql.Tx(ctx, func(ctx context.Context) error {
+		_, err := psql.Fetch[hookedDoc](ctx, nil)
+		return err
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, replica.Queries())
+	_, ok := primary.Find("SELECT")
+	assert.True(t, ok)
+}
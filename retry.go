@@ -0,0 +1,157 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryClassifier is implemented by dialects that can detect transient errors
+// for which the whole transaction can be retried, such as serialization
+// failures or deadlocks.
+//
+// It is separate from [ErrorClassifier] for backward compatibility: adding a
+// method to that interface would make existing dialects stop satisfying it,
+// silently losing their ErrorNumber and IsNotExist classification.
+type RetryClassifier interface {
+	IsRetryable(err error) bool
+}
+
+// IsRetryable returns true if the error is a transient failure after which
+// the transaction can be run again: serialization failures and deadlocks
+// (PostgreSQL/CockroachDB SQLSTATE 40001 and 40P01, MySQL errors 1213 and
+// 1205), as reported by registered RetryClassifier dialects.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// Check registered RetryClassifiers
+	for _, d := range dialects {
+		if rc, ok := d.(RetryClassifier); ok {
+			if rc.IsRetryable(err) {
+				return true
+			}
+		}
+	}
+
+	// Fallback: SQLSTATE exposed by the driver error
+	var st interface{ SQLState() string }
+	if errors.As(err, &st) {
+		switch st.SQLState() {
+		case "40001", "40P01": // serialization_failure, deadlock_detected
+			return true
+		}
+	}
+
+	// Fallback: MySQL deadlock and lock wait timeout
+	switch ErrorNumber(err) {
+	case 1213, 1205:
+		return true
+	}
+	return false
+}
+
+// RetryPolicy configures [TxRetry]. Zero fields use the values of
+// [DefaultRetryPolicy].
+type RetryPolicy struct {
+	MaxAttempts int           // total number of attempts, including the first one
+	BaseDelay   time.Duration // delay before the first retry, doubled after each attempt
+	MaxDelay    time.Duration // upper bound for the delay between attempts
+
+	// Retryable decides whether an error warrants another attempt. Defaults
+	// to [IsRetryable].
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy is used by [TxRetry] when no policy is given.
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   10 * time.Millisecond,
+	MaxDelay:    time.Second,
+}
+
+// TxRetry runs cb inside a transaction like [Tx], and runs the whole
+// transaction again when it fails with a retryable error (see
+// [IsRetryable]), waiting with exponential backoff and jitter between
+// attempts. cb may therefore be called several times and must not have side
+// effects outside the transaction. The last error is returned once
+// MaxAttempts is reached.
+//
+// Retries only happen for the outermost transaction: when ctx already carries
+// a transaction, TxRetry runs cb once in a savepoint like Tx does, and returns
+// the error so that the outer TxRetry can retry the full transaction.
+func TxRetry(ctx context.Context, policy *RetryPolicy, cb func(ctx context.Context) error) error {
+	if inTx(ctx) {
+		return Tx(ctx, cb)
+	}
+	p := policy.resolve()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = Tx(ctx, cb)
+		if err == nil || attempt >= p.MaxAttempts || !p.Retryable(err) {
+			return err
+		}
+		debugLog(ctx, "retrying transaction after attempt %d: %s", attempt, err)
+
+		timer := time.NewTimer(p.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// resolve returns a copy of p with defaults applied.
+func (p *RetryPolicy) resolve() RetryPolicy {
+	var res RetryPolicy
+	if p != nil {
+		res = *p
+	}
+	if res.MaxAttempts <= 0 {
+		res.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if res.BaseDelay <= 0 {
+		res.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if res.MaxDelay <= 0 {
+		res.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if res.Retryable == nil {
+		res.Retryable = IsRetryable
+	}
+	return res
+}
+
+// delay returns the wait before the retry following attempt, picked between
+// half and the full exponential backoff so that concurrent transactions do
+// not retry in lockstep.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxDelay)
+	return d/2 + rand.N(d/2+1)
+}
+
+// inTx returns true if ctx carries a transaction.
+func inTx(ctx context.Context) bool {
+	for {
+		obj := ctx.Value(ctxValueObjFetch)
+		if obj == nil {
+			return false
+		}
+		objV := obj.(*ctxValueObj)
+		switch objV.obj.(type) {
+		case *TxProxy, *sql.Tx:
+			return true
+		}
+		ctx = objV.Context
+	}
+}
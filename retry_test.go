@@ -0,0 +1,99 @@
+package psql_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sqlStateError mimics driver errors exposing a SQLSTATE code.
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sqlstate " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+var fastRetry = &psql.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Microsecond}
+
+func countQueries(db *fakedb.DB, q string) int {
+	n := 0
+	for _, v := range db.Queries() {
+		if v.Query == q {
+			n++
+		}
+	}
+	return n
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, psql.IsRetryable(sqlStateError("40001")))
+	assert.True(t, psql.IsRetryable(fmt.Errorf("wrapped: %w", sqlStateError("40P01"))))
+	assert.False(t, psql.IsRetryable(sqlStateError("23505")))
+	assert.False(t, psql.IsRetryable(errors.New("boom")))
+	assert.False(t, psql.IsRetryable(nil))
+}
+
+func TestTxRetry(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	calls := 0
+	err := psql.TxRetry(ctx, fastRetry, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return sqlStateError("40001")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 3, countQueries(db, "BEGIN"))
+	assert.Equal(t, 2, countQueries(db, "ROLLBACK"))
+	assert.Equal(t, 1, countQueries(db, "COMMIT"))
+}
+
+func TestTxRetryGivesUp(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	calls := 0
+	err := psql.TxRetry(ctx, fastRetry, func(ctx context.Context) error {
+		calls++
+		return sqlStateError("40001")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 3, calls)
+
+	// non retryable errors are returned immediately
+	calls = 0
+	boom := errors.New("boom")
+	err = psql.TxRetry(ctx, fastRetry, func(ctx context.Context) error {
+		calls++
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, 1, calls)
+}
+
+func TestTxRetryNested(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	outer, inner := 0, 0
+	err := psql.TxRetry(ctx, fastRetry, func(ctx context.Context) error {
+		outer++
+		return psql.TxRetry(ctx, fastRetry, func(ctx context.Context) error {
+			inner++
+			if outer < 2 {
+				return sqlStateError("40001")
+			}
+			return nil
+		})
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, outer, "the outer transaction is retried")
+	assert.Equal(t, 2, inner, "savepoints are never retried on their own")
+}
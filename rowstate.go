@@ -2,7 +2,9 @@ package psql
 
 import (
 	"reflect"
+	"runtime"
 	"unsafe"
+	"weak"
 )
 
 type rowState struct {
@@ -16,7 +18,7 @@ type stateIntf interface {
 
 func (t *TableMeta[T]) rowstate(v *T) *rowState {
 	if t.state == -1 {
-		return nil
+		return t.weakState(v)
 	}
 
 	val := reflect.ValueOf(v).Elem().Field(t.state)
@@ -25,3 +27,22 @@ func (t *TableMeta[T]) rowstate(v *T) *rowState {
 
 	return rf.Interface().(stateIntf).state()
 }
+
+// weakState returns the state of v for structs without a Name or Key field to
+// hold it. States are kept in a side table keyed by weak pointers, and removed
+// once v is garbage collected.
+func (t *TableMeta[T]) weakState(v *T) *rowState {
+	wp := weak.Make(v)
+	if st, ok := t.weakStates.Load(wp); ok {
+		return st.(*rowState)
+	}
+	st, loaded := t.weakStates.LoadOrStore(wp, &rowState{})
+	if !loaded {
+		runtime.AddCleanup(v, t.dropWeakState, wp)
+	}
+	return st.(*rowState)
+}
+
+func (t *TableMeta[T]) dropWeakState(wp weak.Pointer[T]) {
+	t.weakStates.Delete(wp)
+}
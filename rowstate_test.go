@@ -0,0 +1,46 @@
+package psql
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+type weakStateObj struct {
+	ID   uint64 `sql:",key=PRIMARY"`
+	Name string `sql:",type=VARCHAR,size=64"`
+}
+
+func countWeakStates[T any](t *TableMeta[T]) int {
+	n := 0
+	t.weakStates.Range(func(k, v any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func TestWeakStateDropped(t *testing.T) {
+	table := Table[weakStateObj]()
+
+	obj := &weakStateObj{ID: 1, Name: "x"}
+	st := table.rowstate(obj)
+	st.init = true
+	if table.rowstate(obj) != st {
+		t.Fatal("state not kept for the same object")
+	}
+	if countWeakStates(table) != 1 {
+		t.Fatal("expected one state")
+	}
+	runtime.KeepAlive(obj)
+	obj = nil
+
+	deadline := time.Now().Add(5 * time.Second)
+	for countWeakStates(table) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("state not dropped after the object was collected")
+		}
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,450 @@
+package psql
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ShardResolver returns the index of the shard holding rows with the given
+// shard key value. The value is the Go value of the shard key field for
+// objects, or the value found in the where clause.
+type ShardResolver func(key any) (int, error)
+
+// HashShards returns a [ShardResolver] distributing keys over n shards by
+// hashing their string representation. Values that format identically (e.g.
+// int 5 and uint64 5) are sent to the same shard. It panics if n is not
+// positive.
+func HashShards(n int) ShardResolver {
+	if n <= 0 {
+		panic(fmt.Sprintf("psql: HashShards requires at least one shard, got %d", n))
+	}
+	return func(key any) (int, error) {
+		h := fnv.New32a()
+		fmt.Fprint(h, key)
+		return int(h.Sum32() % uint32(n)), nil
+	}
+}
+
+// ShardedBackend routes typed operations to one of several backends, based on
+// the value of a shard key. Tables opt in with the shard table attribute,
+// naming the shard key field:
+//
+//	type Order struct {
+//	    psql.Name  `sql:"orders,shard=CustomerID"`
+//	    ID         uint64 `sql:",key=PRIMARY"`
+//	    CustomerID uint64
+//	}
+//
+// Object operations (Insert, Update, Replace, Upsert, DeleteObj) route each
+// object by its shard key field. Where based operations (Get, Fetch, Count,
+// Delete, UpdateWhere, ...) route by the shard key found in a map where
+// clause, or set on the context with [WithShardKey]. Reads without a shard key
+// are sent to every shard and merged if [WithFanOut] is set, otherwise they
+// fail with [ErrShardKeyRequired], as do writes.
+//
+// Transactions run on the shard of the key set on the context, and typed
+// operations in them fail with [ErrShardMismatch] if they target another
+// shard. Tables without the shard attribute, as well as raw queries and
+// transactions started without a shard key in the context, fail with
+// [ErrShardKeyRequired] unless a default shard is set with [WithDefaultShard].
+type ShardedBackend struct {
+	shards   []*Backend
+	resolve  ShardResolver
+	fanOut   bool
+	defShard int // index of the default shard, or -1
+}
+
+// ShardOption is a functional option for [NewShardedBackend].
+type ShardOption func(*ShardedBackend)
+
+// WithFanOut allows reads without a shard key to query all shards and merge
+// the results. Shards are queried in turn. With a Sort, merged results are
+// sorted again, and a Limit applies to them as a whole; a Limit without a Sort
+// is rejected.
+func WithFanOut() ShardOption {
+	return func(sb *ShardedBackend) {
+		sb.fanOut = true
+	}
+}
+
+// WithDefaultShard sets the shard used by tables without the shard attribute,
+// raw queries and transactions when no shard key is set on the context with
+// [WithShardKey].
+func WithDefaultShard(n int) ShardOption {
+	return func(sb *ShardedBackend) {
+		sb.defShard = n
+	}
+}
+
+// NewShardedBackend returns a [ShardedBackend] routing operations to shards
+// using resolve.
+func NewShardedBackend(resolve ShardResolver, shards []*Backend, opts ...ShardOption) *ShardedBackend {
+	if len(shards) == 0 {
+		panic("psql: NewShardedBackend requires at least one shard")
+	}
+	sb := &ShardedBackend{
+		shards:   shards,
+		resolve:  resolve,
+		defShard: -1,
+	}
+	for _, opt := range opts {
+		opt(sb)
+	}
+	if sb.defShard >= len(shards) {
+		panic(fmt.Sprintf("psql: default shard %d out of range 0..%d", sb.defShard, len(shards)-1))
+	}
+	return sb
+}
+
+// Plug attaches the sharded backend to the given context.
+func (sb *ShardedBackend) Plug(ctx context.Context) context.Context {
+	return &ctxValueObj{ctx, sb}
+}
+
+// Shards returns the backends of all shards.
+func (sb *ShardedBackend) Shards() []*Backend {
+	return sb.shards
+}
+
+// Shard returns the backend holding rows with the given shard key.
+func (sb *ShardedBackend) Shard(key any) (*Backend, error) {
+	n, err := sb.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 || n >= len(sb.shards) {
+		return nil, fmt.Errorf("psql: shard resolver returned %d, expected 0..%d", n, len(sb.shards)-1)
+	}
+	return sb.shards[n], nil
+}
+
+type ctxShardKey struct{}
+
+// WithShardKey returns a context carrying a shard key. Operations for which
+// no shard key can be found in their objects or where clause, as well as
+// [GetBackend], resolve the shard using this key.
+func WithShardKey(ctx context.Context, key any) context.Context {
+	return context.WithValue(ctx, ctxShardKey{}, key)
+}
+
+// backendFor returns the backend used for ctx when no operation specific key
+// is available: the shard of the context key, or the default shard. Without
+// either, the first shard is returned, for [GetBackend] to access settings
+// common to all shards; statements never run on it, see contextShard.
+func (sb *ShardedBackend) backendFor(ctx context.Context) *Backend {
+	if be, err := sb.contextShard(ctx); err == nil {
+		return be
+	}
+	return sb.shards[0]
+}
+
+// contextShard returns the shard of the key set on ctx with [WithShardKey],
+// or the default shard.
+func (sb *ShardedBackend) contextShard(ctx context.Context) (*Backend, error) {
+	if key := ctx.Value(ctxShardKey{}); key != nil {
+		return sb.Shard(key)
+	}
+	if sb.defShard >= 0 {
+		return sb.shards[sb.defShard], nil
+	}
+	return nil, fmt.Errorf("%w: no shard key on the context and no default shard", ErrShardKeyRequired)
+}
+
+// shardedFromContext returns the [ShardedBackend] of ctx, if it is the
+// innermost database object (i.e. no shard, transaction or connection was
+// selected yet).
+func shardedFromContext(ctx context.Context) *ShardedBackend {
+	sb, _ := ctx.Value(ctxDataObj).(*ShardedBackend)
+	return sb
+}
+
+// runSharded routes op to the right shard(s) and runs it using run.
+func (t *TableMeta[T]) runSharded(ctx context.Context, sb *ShardedBackend, op *Operation, run Handler) error {
+	if t.shardKey == nil {
+		be, err := sb.contextShard(ctx)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", op.Type, t.table, err)
+		}
+		return run(be.Plug(ctx), op)
+	}
+
+	if op.Objects != nil {
+		return t.runShardedObjects(ctx, sb, op, run)
+	}
+
+	key, ok := t.whereShardKey(op.Where)
+	if !ok {
+		key = ctx.Value(ctxShardKey{})
+		ok = key != nil
+	}
+	if ok {
+		be, err := sb.Shard(key)
+		if err != nil {
+			return err
+		}
+		return run(be.Plug(ctx), op)
+	}
+
+	if !sb.fanOut || op.Type.IsWrite() || op.noFanOut {
+		return fmt.Errorf("%w: %s %s", ErrShardKeyRequired, op.Type, t.table)
+	}
+
+	// fan out: run on every shard and merge results
+	var opt *FetchOptions
+	if op.Type == OpFetch {
+		opt = op.Options
+	}
+	var less func(a, b any) bool
+	sub := *op
+	if opt != nil && len(opt.Sort) > 0 {
+		var err error
+		if less, err = t.fanOutLess(opt.Sort); err != nil {
+			return fmt.Errorf("%s %s: %w", op.Type, t.table, err)
+		}
+		if opt.LimitCount > 0 {
+			// each shard returns enough rows to fill the page once merged
+			o := *opt
+			o.LimitCount += o.LimitStart
+			o.LimitStart = 0
+			sub.Options = &o
+		}
+	} else if opt != nil && opt.LimitCount > 0 && !op.single {
+		return fmt.Errorf("psql: %s %s: Limit on a query sent to every shard requires a Sort", op.Type, t.table)
+	}
+
+	found := false
+	for _, be := range sb.shards {
+		sub := sub
+		sub.Objects = nil
+		err := run(be.Plug(ctx), &sub)
+		if op.single && errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		op.Objects = append(op.Objects, sub.Objects...)
+		found = true
+		if op.single && less == nil {
+			break
+		}
+	}
+	if op.single && !found {
+		return os.ErrNotExist
+	}
+	if less == nil {
+		return nil
+	}
+
+	sort.SliceStable(op.Objects, func(i, j int) bool {
+		return less(op.Objects[i], op.Objects[j])
+	})
+	if op.single {
+		op.Objects = op.Objects[:1]
+		return nil
+	}
+	if opt.LimitCount > 0 {
+		start := min(opt.LimitStart, len(op.Objects))
+		end := min(start+opt.LimitCount, len(op.Objects))
+		op.Objects = op.Objects[start:end]
+	}
+	return nil
+}
+
+// fanOutLess returns a function ordering objects as order would, to merge the
+// results of several shards. Values are compared as Go values, which may
+// differ from the database collation for strings.
+func (t *TableMeta[T]) fanOutLess(order []SortValueable) (func(a, b any) bool, error) {
+	type sortKey struct {
+		index int
+		desc  bool
+	}
+	keys := make([]sortKey, 0, len(order))
+	for _, s := range order {
+		var desc bool
+		if o, ok := s.(*ordField); ok {
+			desc = o.ord == "DESC"
+			s, ok = o.fld.(SortValueable)
+			if !ok {
+				return nil, fmt.Errorf("cannot merge shards sorted by %s", o.sortEscapeValue())
+			}
+		}
+		var name string
+		switch f := s.(type) {
+		case fieldName:
+			name = string(f)
+		case *fullField:
+			name = string(f.fieldName)
+		default:
+			return nil, fmt.Errorf("cannot merge shards sorted by %s", s.sortEscapeValue())
+		}
+		fld := findFieldByNameOrCol(t.fldcol, name)
+		if fld == nil {
+			return nil, fmt.Errorf("cannot merge shards sorted by unknown field %s", name)
+		}
+		keys = append(keys, sortKey{fld.Index, desc})
+	}
+
+	return func(a, b any) bool {
+		va := reflect.ValueOf(a).Elem()
+		vb := reflect.ValueOf(b).Elem()
+		for _, k := range keys {
+			c := compareValues(va.Field(k.index), vb.Field(k.index))
+			if c == 0 {
+				continue
+			}
+			if k.desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	}, nil
+}
+
+// compareValues compares two values of the same type, nil pointers first.
+// Values of types without a natural order compare as equal.
+func compareValues(a, b reflect.Value) int {
+	for a.Kind() == reflect.Ptr {
+		switch {
+		case a.IsNil() && b.IsNil():
+			return 0
+		case a.IsNil():
+			return -1
+		case b.IsNil():
+			return 1
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+	if ta, ok := a.Interface().(time.Time); ok {
+		return ta.Compare(b.Interface().(time.Time))
+	}
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp.Compare(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return cmp.Compare(a.Uint(), b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return cmp.Compare(a.Float(), b.Float())
+	case reflect.String:
+		return cmp.Compare(a.String(), b.String())
+	case reflect.Bool:
+		switch {
+		case a.Bool() == b.Bool():
+			return 0
+		case a.Bool():
+			return 1
+		default:
+			return -1
+		}
+	}
+	return 0
+}
+
+// runShardedObjects groups the objects of op by shard and runs op once per
+// shard.
+func (t *TableMeta[T]) runShardedObjects(ctx context.Context, sb *ShardedBackend, op *Operation, run Handler) error {
+	var order []*Backend
+	groups := make(map[*Backend][]any)
+	for _, obj := range op.Objects {
+		v := reflect.ValueOf(obj)
+		if v.Kind() != reflect.Ptr || v.IsNil() {
+			return fmt.Errorf("psql: cannot route %T to a shard", obj)
+		}
+		be, err := sb.Shard(v.Elem().Field(t.shardKey.Index).Interface())
+		if err != nil {
+			return err
+		}
+		if _, ok := groups[be]; !ok {
+			order = append(order, be)
+		}
+		groups[be] = append(groups[be], obj)
+	}
+
+	if len(order) == 1 {
+		return run(order[0].Plug(ctx), op)
+	}
+	for _, be := range order {
+		sub := *op
+		sub.Objects = groups[be]
+		if err := run(be.Plug(ctx), &sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// txShard checks that op, run in a transaction started on a
+// [ShardedBackend], only involves rows of the transaction's shard.
+func (t *TableMeta[T]) txShard(ctx context.Context, op *Operation) error {
+	if t.shardKey == nil {
+		return nil
+	}
+	tx := txFromContext(ctx)
+	if tx == nil || tx.ctrl.sharded == nil {
+		return nil
+	}
+	check := func(key any) error {
+		be, err := tx.ctrl.sharded.Shard(key)
+		if err != nil {
+			return err
+		}
+		if be != tx.ctrl.shard {
+			return fmt.Errorf("%w: %s %s", ErrShardMismatch, op.Type, t.table)
+		}
+		return nil
+	}
+
+	if op.Objects != nil {
+		for _, obj := range op.Objects {
+			v := reflect.ValueOf(obj)
+			if v.Kind() != reflect.Ptr || v.IsNil() {
+				return fmt.Errorf("psql: cannot route %T to a shard", obj)
+			}
+			if err := check(v.Elem().Field(t.shardKey.Index).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if key, ok := t.whereShardKey(op.Where); ok {
+		return check(key)
+	}
+	if key := ctx.Value(ctxShardKey{}); key != nil {
+		return check(key)
+	}
+	// no key: the operation runs on the transaction's shard
+	return nil
+}
+
+// whereShardKey extracts the shard key value from a map where clause.
+func (t *TableMeta[T]) whereShardKey(where any) (any, bool) {
+	m, ok := where.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	v, ok := m[t.shardKey.Column]
+	if !ok {
+		v, ok = m[t.shardKey.Name]
+	}
+	if !ok || v == nil {
+		return nil, false
+	}
+	switch v.(type) {
+	case EscapeValueable:
+		// comparison operators cannot be routed
+		return nil, false
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return nil, false
+	}
+	return v, true
+}
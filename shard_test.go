@@ -0,0 +1,206 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type shardedOrder struct {
+	psql.Name  `sql:"sharded_orders,shard=CustomerID"`
+	ID         uint64 `sql:",key=PRIMARY"`
+	CustomerID uint64
+	Total      int64
+}
+
+// newShards returns two fake shards, keys being routed by parity.
+func newShards(t *testing.T, opts ...psql.ShardOption) ([]*fakedb.DB, *psql.ShardedBackend, context.Context) {
+	t.Helper()
+	var fakes []*fakedb.DB
+	var backends []*psql.Backend
+	for range 2 {
+		f := &fakedb.DB{}
+		db := sql.OpenDB(f)
+		t.Cleanup(func() { db.Close() })
+		fakes = append(fakes, f)
+		backends = append(backends, psql.NewBackend(psql.EngineSQLite, db))
+	}
+	resolve := func(key any) (int, error) {
+		return int(key.(uint64) % 2), nil
+	}
+	sb := psql.NewShardedBackend(resolve, backends, opts...)
+	return fakes, sb, sb.Plug(context.Background())
+}
+
+func TestShardInsertGroupsObjects(t *testing.T) {
+	fakes, _, ctx := newShards(t)
+
+	require.NoError(t, psql.Insert(ctx,
+		&shardedOrder{ID: 1, CustomerID: 10},
+		&shardedOrder{ID: 2, CustomerID: 11},
+		&shardedOrder{ID: 3, CustomerID: 12},
+	))
+
+	count := func(f *fakedb.DB) int {
+		n := 0
+		for _, q := range f.Queries() {
+			if len(q.Args) > 0 {
+				n++
+			}
+		}
+		return n
+	}
+	assert.Equal(t, 2, count(fakes[0]))
+	assert.Equal(t, 1, count(fakes[1]))
+}
+
+func TestShardGetByWhere(t *testing.T) {
+	fakes, _, ctx := newShards(t)
+	fakes[1].OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{
+			Cols: []string{"ID", "CustomerID", "Total"},
+			Data: [][]driver.Value{{"5", "11", "100"}},
+		}, nil
+	}
+
+	o, err := psql.Get[shardedOrder](ctx, map[string]any{"CustomerID": uint64(11), "ID": 5})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), o.Total)
+	assert.Empty(t, fakes[0].Queries())
+}
+
+func TestShardKeyRequired(t *testing.T) {
+	fakes, _, ctx := newShards(t)
+
+	_, err := psql.Fetch[shardedOrder](ctx, nil)
+	assert.ErrorIs(t, err, psql.ErrShardKeyRequired)
+	_, err = psql.Delete[shardedOrder](ctx, map[string]any{"ID": 1})
+	assert.ErrorIs(t, err, psql.ErrShardKeyRequired)
+
+	// a shard key on the context is enough
+	_, err = psql.Fetch[shardedOrder](psql.WithShardKey(ctx, uint64(3)), nil)
+	require.NoError(t, err)
+	assert.Empty(t, fakes[0].Queries())
+	assert.Len(t, fakes[1].Queries(), 1)
+}
+
+func TestShardFanOut(t *testing.T) {
+	fakes, _, ctx := newShards(t, psql.WithFanOut())
+	for i, f := range fakes {
+		row := []driver.Value{string(rune('1' + i)), "10", "1"}
+		f.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+			return &fakedb.Rows{Cols: []string{"ID", "CustomerID", "Total"}, Data: [][]driver.Value{row}}, nil
+		}
+	}
+
+	res, err := psql.Fetch[shardedOrder](ctx, nil)
+	require.NoError(t, err)
+	assert.Len(t, res, 2)
+
+	_, err = psql.Delete[shardedOrder](ctx, nil)
+	assert.ErrorIs(t, err, psql.ErrShardKeyRequired, "writes never fan out")
+}
+
+func TestShardGetBackend(t *testing.T) {
+	_, sb, ctx := newShards(t)
+
+	assert.Same(t, sb.Shards()[0], psql.GetBackend(ctx))
+	assert.Same(t, sb.Shards()[1], psql.GetBackend(psql.WithShardKey(ctx, uint64(7))))
+}
+
+type shardedSetting struct {
+	psql.Name `sql:"sharded_settings"`
+	ID        uint64 `sql:",key=PRIMARY"`
+}
+
+func TestShardDefault(t *testing.T) {
+	_, _, ctx := newShards(t)
+
+	_, err := psql.Fetch[shardedSetting](ctx, nil)
+	assert.ErrorIs(t, err, psql.ErrShardKeyRequired, "tables without shard attribute need a default shard")
+	assert.ErrorIs(t, psql.Q("SELECT 1").Each(ctx, func(*sql.Rows) error { return nil }), psql.ErrShardKeyRequired)
+	err = psql.Tx(ctx, func(ctx context.Context) error { return nil })
+	assert.ErrorIs(t, err, psql.ErrShardKeyRequired)
+
+	fakes, sb, ctx := newShards(t, psql.WithDefaultShard(1))
+	_, err = psql.Fetch[shardedSetting](ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, fakes[0].Queries())
+	assert.Len(t, fakes[1].Queries(), 1)
+	assert.Same(t, sb.Shards()[1], psql.GetBackend(ctx))
+}
+
+func TestHashShards(t *testing.T) {
+	assert.Panics(t, func() { psql.HashShards(0) })
+
+	n, err := psql.HashShards(3)(uint64(42))
+	require.NoError(t, err)
+	assert.True(t, n >= 0 && n < 3)
+}
+
+func TestShardTx(t *testing.T) {
+	fakes, _, ctx := newShards(t)
+
+	err := psql.Tx(psql.WithShardKey(ctx, uint64(10)), func(ctx context.Context) error {
+		if err := psql.Insert(ctx, &shardedOrder{ID: 1, CustomerID: 12}); err != nil {
+			return err
+		}
+		return psql.Insert(ctx, &shardedOrder{ID: 2, CustomerID: 11})
+	})
+	assert.ErrorIs(t, err, psql.ErrShardMismatch)
+	assert.Empty(t, fakes[1].Queries(), "nothing runs on the other shard")
+
+	err = psql.Tx(psql.WithShardKey(ctx, uint64(10)), func(ctx context.Context) error {
+		_, err := psql.Fetch[shardedOrder](ctx, map[string]any{"CustomerID": uint64(13)})
+		return err
+	})
+	assert.ErrorIs(t, err, psql.ErrShardMismatch)
+}
+
+func TestShardFanOutSortLimit(t *testing.T) {
+	fakes, _, ctx := newShards(t, psql.WithFanOut())
+	rows := [][][]driver.Value{
+		{{"1", "10", "50"}, {"3", "10", "30"}, {"5", "10", "10"}},
+		{{"2", "11", "40"}, {"4", "11", "20"}},
+	}
+	for i, f := range fakes {
+		f.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+			return &fakedb.Rows{Cols: []string{"ID", "CustomerID", "Total"}, Data: rows[i]}, nil
+		}
+	}
+
+	res, err := psql.Fetch[shardedOrder](ctx, nil, psql.Sort(psql.S("Total", "DESC")), psql.LimitFrom(1, 2))
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, []uint64{2, 3}, []uint64{res[0].ID, res[1].ID})
+	for _, f := range fakes {
+		assert.Contains(t, f.Last().Query, `ORDER BY "Total" DESC LIMIT 3`, "each shard returns the rows up to the end of the page")
+	}
+
+	// the fake shards return their first row as is: 50 and 40
+	o, err := psql.Get[shardedOrder](ctx, nil, psql.Sort(psql.S("Total")))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), o.ID, "the first row over all shards")
+
+	_, err = psql.Fetch[shardedOrder](ctx, nil, psql.Limit(10))
+	assert.Error(t, err, "Limit without Sort")
+
+	mapped, err := psql.FetchMapped[shardedOrder](ctx, nil, "ID", psql.Sort(psql.S("Total", "DESC")), psql.LimitFrom(1, 2))
+	require.NoError(t, err)
+	assert.Len(t, mapped, 2)
+	assert.Contains(t, mapped, "2")
+	assert.Contains(t, mapped, "3")
+
+	grouped, err := psql.FetchGrouped[shardedOrder](ctx, nil, "CustomerID", psql.Sort(psql.S("Total", "DESC")), psql.Limit(3))
+	require.NoError(t, err)
+	require.Len(t, grouped, 2)
+	assert.Len(t, grouped["10"], 2)
+	assert.Equal(t, uint64(2), grouped["11"][0].ID)
+	assert.Equal(t, []uint64{1, 3}, []uint64{grouped["10"][0].ID, grouped["10"][1].ID}, "groups keep the merged order")
+}
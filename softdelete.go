@@ -3,6 +3,8 @@ package psql
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"log/slog"
 	"reflect"
 	"time"
@@ -33,6 +35,22 @@ func Restore[T any](ctx context.Context, where any) (sql.Result, error) {
 }
 
 func (t *TableMeta[T]) Restore(ctx context.Context, where any) (sql.Result, error) {
+	if t == nil {
+		return nil, ErrNotReady
+	}
+	op := &Operation{Type: OpUpdateWhere, Where: where, Options: IncludeDeleted()}
+	if t.softDelete != nil {
+		op.Values = map[string]any{t.softDelete.Name: nil}
+	}
+	err := t.runOp(ctx, op, func(ctx context.Context, op *Operation) error {
+		var err error
+		op.Result, err = t.restore(ctx, op.Where, op.Values)
+		return err
+	})
+	return op.Result, err
+}
+
+func (t *TableMeta[T]) restore(ctx context.Context, where any, fields map[string]any) (sql.Result, error) {
 	if t == nil {
 		return nil, ErrNotReady
 	}
@@ -41,14 +59,42 @@ func (t *TableMeta[T]) Restore(ctx context.Context, where any) (sql.Result, erro
 	}
 	t.check(ctx)
 
+	set := make(map[string]any, len(fields))
+	for name, v := range fields {
+		f := findFieldByNameOrCol(t.fldcol, name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown field %q on table %s", name, t.table)
+		}
+		if f == t.tenant {
+			return nil, fmt.Errorf("%w: %s cannot be set on %s", ErrTenantMismatch, f.Name, t.table)
+		}
+		if v == nil {
+			v = Raw("NULL")
+		}
+		set[f.Column] = v
+	}
+	if len(set) == 0 {
+		return nil, errors.New("Restore requires at least one field to set")
+	}
+
 	be := GetBackend(ctx)
 	req := B().Update(t.FormattedName(be)).
-		Set(map[string]any{t.softDelete.Column: Raw("NULL")}).
+		Set(set).
 		Where(where)
+	if err := t.applyTenant(ctx, req); err != nil {
+		return nil, err
+	}
+	before, err := t.historyBefore(ctx, where, &FetchOptions{}, true)
+	if err != nil {
+		return nil, err
+	}
 	res, err := req.ExecQuery(ctx)
 	if err != nil {
 		slog.ErrorContext(ctx, err.Error()+"\n"+debugStack(), "event", "psql:restore:run_fail", "psql.table", t.table)
 		return nil, err
 	}
+	if err := t.historyAfter(ctx, "restore", before); err != nil {
+		return nil, err
+	}
 	return res, nil
 }
@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/KarpelesLab/typutil"
 )
@@ -41,12 +42,20 @@ type TableMeta[T any] struct {
 	fldcol       map[string]*StructField
 	keys         []*StructKey
 	mainKey      *StructKey
-	fldStr       string // string of all fields
-	state        int
+	fldStr       string   // string of all fields
+	state        int      // index of the Name or Key field holding the row state, or -1
+	weakStates   sync.Map // weak.Pointer[T] → *rowState, for structs without Name or Key
 	attrs        map[string]string
-	futures      sync.Map
+	cacheGen     atomic.Uint64         // bumped on writes to invalidate Cached results
+	cacheUsed    atomic.Bool           // set once a Cached fetch ran on the table
 	assocs       map[string]*assocMeta // association metadata by Go field name
 	softDelete   *StructField          // non-nil if soft delete is enabled
+	shardKey     *StructField          // non-nil if the table is sharded (shard= table attribute)
+	tenant       *StructField          // non-nil if rows are scoped by tenant (tenant= table attribute)
+	history      bool                  // true if changes are recorded in a history table (history table attribute)
+	version      *StructField          // non-nil if optimistic locking is enabled
+	createdAt    *StructField          // non-nil if creation time is set automatically
+	updatedAt    *StructField          // non-nil if update time is set automatically
 }
 
 type TableMetaIntf interface {
@@ -169,9 +178,20 @@ func Table[T any]() *TableMeta[T] {
 			}
 		}
 
-		if len(attrs) == 0 {
-			// import based on type
-			attrs["import"] = finfo.Type.String()
+		autoCreate, noAutoCreate := autoTimeAttr(attrs, "autoCreateTime")
+		autoUpdate, noAutoUpdate := autoTimeAttr(attrs, "autoUpdateTime")
+		if (autoCreate || autoUpdate) && !isTimeType(finfo.Type) {
+			panic(fmt.Sprintf("auto timestamp field %s must be a time.Time or *time.Time, got %s", finfo.Name, finfo.Type))
+		}
+
+		if len(attrs) == 0 || onlyBehaviorAttrs(attrs) {
+			if autoCreate || autoUpdate {
+				// auto timestamps default to microsecond precision
+				attrs["import"] = "TS"
+			} else {
+				// import based on type
+				attrs["import"] = finfo.Type.String()
+			}
 		}
 
 		var setter func(reflect.Value, sql.RawBytes) error
@@ -207,12 +227,47 @@ func Table[T any]() *TableMeta[T] {
 		if _, ok := attrs["softdelete"]; ok || (finfo.Name == "DeletedAt" && finfo.Type == ptrTimeType) {
 			info.softDelete = fld
 		}
+
+		if _, ok := attrs["version"]; ok {
+			if !isVersionType(finfo.Type) {
+				panic(fmt.Sprintf("version field %s must be an integer or time.Time, got %s", finfo.Name, finfo.Type))
+			}
+			info.version = fld
+		}
+
+		// Detect auto timestamps: time fields named CreatedAt/UpdatedAt, or
+		// tagged with autoCreateTime/autoUpdateTime
+		if autoCreate || (!noAutoCreate && finfo.Name == "CreatedAt" && isTimeType(finfo.Type)) {
+			info.createdAt = fld
+		}
+		if autoUpdate || (!noAutoUpdate && finfo.Name == "UpdatedAt" && isTimeType(finfo.Type)) {
+			info.updatedAt = fld
+		}
 	}
 
 	if len(info.fields) == 0 {
 		panic("no fields for table")
 	}
 
+	if name, ok := info.attrs["shard"]; ok {
+		info.shardKey = findFieldByNameOrCol(info.fldcol, name)
+		if info.shardKey == nil {
+			panic(fmt.Sprintf("shard key %s not found in table %s", name, info.table))
+		}
+	}
+	if name, ok := info.attrs["tenant"]; ok {
+		info.tenant = findFieldByNameOrCol(info.fldcol, name)
+		if info.tenant == nil {
+			panic(fmt.Sprintf("tenant field %s not found in table %s", name, info.table))
+		}
+	}
+	if _, ok := info.attrs["history"]; ok {
+		if info.mainKey == nil {
+			panic(fmt.Sprintf("table %s has history enabled but no unique key", info.table))
+		}
+		info.history = true
+	}
+
 	info.fldStr = strings.Join(names, ",")
 
 	tableMapL.Lock()
@@ -222,6 +277,25 @@ func Table[T any]() *TableMeta[T] {
 	return info
 }
 
+// behaviorAttrs lists tag attributes that change how psql handles a field
+// without describing its SQL type.
+var behaviorAttrs = map[string]bool{
+	"version":        true,
+	"autoCreateTime": true,
+	"autoUpdateTime": true,
+}
+
+// onlyBehaviorAttrs returns true if attrs contains nothing but behavior
+// attributes, meaning the column type must still be derived from the Go type.
+func onlyBehaviorAttrs(attrs map[string]string) bool {
+	for k := range attrs {
+		if !behaviorAttrs[k] {
+			return false
+		}
+	}
+	return true
+}
+
 func (t *TableMeta[T]) Name() string {
 	if t == nil {
 		return ""
@@ -313,79 +387,12 @@ func (t *TableMeta[T]) ScanTo(ctx context.Context, row *sql.Rows, v *T) error {
 }
 
 func (t *TableMeta[T]) scanValue(ctx context.Context, rows *sql.Rows, target *T) error {
-	val := reflect.ValueOf(target).Elem()
-	st := t.rowstate(target)
-
-	// Make a slice for the values, and a reference interface slice
-	cols, err := rows.Columns()
+	cols, values, err := t.scanRow(rows)
 	if err != nil {
 		return err
 	}
-	n := len(cols)
-
-	values := make([]sql.RawBytes, n)
-	scan := make([]interface{}, n)
-	for i := range values {
-		scan[i] = &values[i]
-	}
-
-	// scan
-	err = rows.Scan(scan...)
-	if err != nil {
-		slog.Error(fmt.Sprintf("scan err %s", err), "event", "psql:table:scan_error", "psql.table", t.table)
-		return fmt.Errorf("scan error: %w", err)
-	}
-
-	if st != nil {
-		st.init = true
-		st.val = make(map[string]any)
-	}
-
-	// perform set
-	for i := 0; i < n; i += 1 {
-		fld, ok := t.fldcol[cols[i]]
-		if !ok {
-			// maybe report this as a warning?
-			continue
-		}
-		f := val.Field(fld.Index)
-		// if nil, set to nil
-		if values[i] == nil {
-			if f.Kind() == reflect.Ptr {
-				if !f.IsNil() {
-					f.Set(reflect.Zero(f.Type()))
-				}
-			}
-			continue
-		}
-		// make sure "f" is a settable value (not a ptr), allocate if needed
-		for f.Kind() == reflect.Ptr {
-			if f.IsNil() {
-				f.Set(reflect.New(f.Type().Elem()))
-			}
-			f = f.Elem()
-		}
-		err = fld.setter(f, values[i])
-		if err != nil {
-			return fmt.Errorf("on field %s: %w", fld.Name, err)
-		}
-		if st != nil {
-			if fld.Attrs["format"] == "json" {
-				// Store raw JSON for state; DeepClone can't handle map[string]any
-				st.val[cols[i]] = string(values[i])
-			} else {
-				v := reflect.New(f.Type()).Elem()
-				vp := v
-				for vp.Kind() == reflect.Ptr {
-					if vp.IsNil() {
-						vp.Set(reflect.New(vp.Type().Elem()))
-					}
-					vp = vp.Elem()
-				}
-				fld.setter(vp, values[i])
-				st.val[cols[i]] = typutil.DeepClone(v.Interface())
-			}
-		}
+	if err := t.loadValues(target, cols, values); err != nil {
+		return err
 	}
 
 	if h, ok := any(target).(AfterScanHook); ok {
@@ -400,12 +407,22 @@ func (t *TableMeta[T]) scanValue(ctx context.Context, rows *sql.Rows, target *T)
 // scanValueReturning is like scanValue but skips AfterScanHook. Used for
 // RETURNING clauses where the scan is part of an INSERT/REPLACE, not a SELECT.
 func (t *TableMeta[T]) scanValueReturning(ctx context.Context, rows *sql.Rows, target *T) error {
-	val := reflect.ValueOf(target).Elem()
-	st := t.rowstate(target)
+	cols, values, err := t.scanRow(rows)
+	if err != nil {
+		return err
+	}
+	// AfterScanHook is intentionally NOT called here since this is a
+	// RETURNING scan, not a user-initiated SELECT.
+	return t.loadValues(target, cols, values)
+}
 
+// scanRow returns the columns and raw values of the current row. The values
+// are only valid until the next call to rows.Next.
+func (t *TableMeta[T]) scanRow(rows *sql.Rows) ([]string, []sql.RawBytes, error) {
+	// Make a slice for the values, and a reference interface slice
 	cols, err := rows.Columns()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	n := len(cols)
 
@@ -415,43 +432,60 @@ func (t *TableMeta[T]) scanValueReturning(ctx context.Context, rows *sql.Rows, t
 		scan[i] = &values[i]
 	}
 
+	// scan
 	err = rows.Scan(scan...)
 	if err != nil {
 		slog.Error(fmt.Sprintf("scan err %s", err), "event", "psql:table:scan_error", "psql.table", t.table)
-		return fmt.Errorf("scan error: %w", err)
+		return nil, nil, fmt.Errorf("scan error: %w", err)
 	}
+	return cols, values, nil
+}
+
+// loadValues sets the fields of target from raw column values, and resets its
+// row state to them.
+func (t *TableMeta[T]) loadValues(target *T, cols []string, values []sql.RawBytes) error {
+	val := reflect.ValueOf(target).Elem()
+	st := t.rowstate(target)
 
 	if st != nil {
 		st.init = true
 		st.val = make(map[string]any)
 	}
 
-	for i := 0; i < n; i += 1 {
+	// perform set
+	for i := range cols {
 		fld, ok := t.fldcol[cols[i]]
 		if !ok {
+			// maybe report this as a warning?
 			continue
 		}
 		f := val.Field(fld.Index)
+		// if nil, set to nil
 		if values[i] == nil {
 			if f.Kind() == reflect.Ptr {
 				if !f.IsNil() {
 					f.Set(reflect.Zero(f.Type()))
 				}
 			}
+			if st != nil {
+				st.val[cols[i]] = reflect.Zero(f.Type()).Interface()
+			}
 			continue
 		}
+		// make sure "f" is a settable value (not a ptr), allocate if needed
 		for f.Kind() == reflect.Ptr {
 			if f.IsNil() {
 				f.Set(reflect.New(f.Type().Elem()))
 			}
 			f = f.Elem()
 		}
-		err = fld.setter(f, values[i])
+		err := fld.setter(f, values[i])
 		if err != nil {
 			return fmt.Errorf("on field %s: %w", fld.Name, err)
 		}
 		if st != nil {
 			if fld.Attrs["format"] == "json" {
+				// Store raw JSON for state; DeepClone can't handle map[string]any
 				st.val[cols[i]] = string(values[i])
 			} else {
 				v := reflect.New(f.Type()).Elem()
@@ -467,8 +501,5 @@ func (t *TableMeta[T]) scanValueReturning(ctx context.Context, rows *sql.Rows, t
 			}
 		}
 	}
-
-	// AfterScanHook is intentionally NOT called here since this is a
-	// RETURNING scan, not a user-initiated SELECT.
 	return nil
 }
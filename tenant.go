@@ -0,0 +1,141 @@
+package psql
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+type ctxTenantKey struct{}
+
+// WithTenant returns a context scoping typed operations to the given tenant.
+//
+// Tables opt in with the tenant table attribute, naming the tenant field:
+//
+//	type Order struct {
+//	    psql.Name `sql:"orders,tenant=TenantID"`
+//	    ID        uint64 `sql:",key=PRIMARY"`
+//	    TenantID  uint64
+//	}
+//
+// Reads, [UpdateWhere], [Delete] and [Restore] on such tables only match rows
+// of the tenant, Insert, Replace and Upsert set the tenant field on objects
+// where it is zero, and Update and [DeleteObj] only apply to rows of the
+// tenant. Objects carrying a different tenant, and [UpdateWhere] or
+// [Restore] values setting the tenant field, are rejected with
+// [ErrTenantMismatch], and any operation on a tenant table fails with
+// [ErrTenantRequired] if ctx has no tenant.
+//
+// Only typed operations are scoped: the query builder and raw queries are
+// not.
+func WithTenant(ctx context.Context, id any) context.Context {
+	return context.WithValue(ctx, ctxTenantKey{}, id)
+}
+
+// TenantFromContext returns the tenant set with [WithTenant], if any.
+func TenantFromContext(ctx context.Context) (any, bool) {
+	id := ctx.Value(ctxTenantKey{})
+	return id, id != nil
+}
+
+// tenantValue returns the tenant of ctx as a value of the type of the tenant
+// field. Only integers are converted, as long as their value fits; other
+// types must match the field. It must only be called for tenant tables.
+func (t *TableMeta[T]) tenantValue(ctx context.Context) (reflect.Value, error) {
+	id, ok := TenantFromContext(ctx)
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("%w: table %s", ErrTenantRequired, t.table)
+	}
+	typ := t.typ.Field(t.tenant.Index).Type
+	v := reflect.ValueOf(id)
+	if v.Type() == typ {
+		return v, nil
+	}
+	if res, ok := convertInt(v, typ); ok {
+		return res, nil
+	}
+	return reflect.Value{}, fmt.Errorf("psql: tenant %v of type %T cannot be used for %s.%s of type %s", id, id, t.table, t.tenant.Name, typ)
+}
+
+// convertInt converts the integer v to the integer type typ, failing if v
+// is not an integer or its value does not fit in typ.
+func convertInt(v reflect.Value, typ reflect.Type) (reflect.Value, bool) {
+	res := reflect.New(typ).Elem()
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := v.Int()
+		switch typ.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if res.OverflowInt(n) {
+				return res, false
+			}
+			res.SetInt(n)
+			return res, true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if n < 0 || res.OverflowUint(uint64(n)) {
+				return res, false
+			}
+			res.SetUint(uint64(n))
+			return res, true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n := v.Uint()
+		switch typ.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if n > math.MaxInt64 || res.OverflowInt(int64(n)) {
+				return res, false
+			}
+			res.SetInt(int64(n))
+			return res, true
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if res.OverflowUint(n) {
+				return res, false
+			}
+			res.SetUint(n)
+			return res, true
+		}
+	}
+	return res, false
+}
+
+// applyTenant adds a WHERE condition restricting req to the tenant of ctx if
+// the table has a tenant field.
+func (t *TableMeta[T]) applyTenant(ctx context.Context, req *QueryBuilder) error {
+	if t.tenant == nil {
+		return nil
+	}
+	v, err := t.tenantValue(ctx)
+	if err != nil {
+		return err
+	}
+	req.Where(map[string]any{t.tenant.Column: v.Interface()})
+	return nil
+}
+
+// tenantObjects sets the tenant of ctx on the objects of op where their
+// tenant field is zero, and rejects objects belonging to another tenant.
+func (t *TableMeta[T]) tenantObjects(ctx context.Context, op *Operation) error {
+	if t.tenant == nil || op.Objects == nil {
+		return nil
+	}
+	v, err := t.tenantValue(ctx)
+	if err != nil {
+		return err
+	}
+	for _, obj := range op.Objects {
+		o, ok := obj.(*T)
+		if !ok || o == nil {
+			continue
+		}
+		f := reflect.ValueOf(o).Elem().Field(t.tenant.Index)
+		if f.IsZero() {
+			f.Set(v)
+			continue
+		}
+		if !f.Equal(v) {
+			return fmt.Errorf("%w: %s has %s=%v", ErrTenantMismatch, t.table, t.tenant.Name, f.Interface())
+		}
+	}
+	return nil
+}
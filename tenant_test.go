@@ -0,0 +1,110 @@
+package psql_test
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tenantOrder struct {
+	psql.Name `sql:"tenant_orders,tenant=TenantID"`
+	ID        uint64 `sql:",key=PRIMARY"`
+	TenantID  uint64
+	Total     int64
+}
+
+func TestTenantRequired(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	_, err := psql.Fetch[tenantOrder](ctx, nil)
+	assert.ErrorIs(t, err, psql.ErrTenantRequired)
+	_, err = psql.Count[tenantOrder](ctx, nil)
+	assert.ErrorIs(t, err, psql.ErrTenantRequired)
+	_, err = psql.Delete[tenantOrder](ctx, map[string]any{"ID": 1})
+	assert.ErrorIs(t, err, psql.ErrTenantRequired)
+	assert.ErrorIs(t, psql.Insert(ctx, &tenantOrder{ID: 1}), psql.ErrTenantRequired)
+	assert.Empty(t, db.Queries())
+}
+
+func TestTenantScopesQueries(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	ctx = psql.WithTenant(ctx, 42) // converted to the field type
+
+	_, err := psql.Fetch[tenantOrder](ctx, map[string]any{"Total": 10})
+	require.NoError(t, err)
+	q := db.Last()
+	assert.Contains(t, q.Query, `"TenantID"=`)
+	assert.Contains(t, q.Args, driver.Value(int64(42)))
+
+	_, err = psql.UpdateWhere[tenantOrder](ctx, nil, map[string]any{"Total": 0})
+	require.NoError(t, err)
+	assert.Contains(t, db.Last().Query, `WHERE ("TenantID"=`)
+
+	_, err = psql.Delete[tenantOrder](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	assert.Contains(t, db.Last().Query, `"TenantID"=`)
+}
+
+func TestTenantObjects(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	ctx = psql.WithTenant(ctx, uint64(7))
+
+	o := &tenantOrder{ID: 1, Total: 5}
+	require.NoError(t, psql.Insert(ctx, o))
+	assert.Equal(t, uint64(7), o.TenantID)
+	assert.Contains(t, db.Last().Args, driver.Value(int64(7)))
+
+	require.NoError(t, psql.DeleteObj(ctx, o))
+	assert.Contains(t, db.Last().Query, `"TenantID"=`)
+
+	other := &tenantOrder{ID: 2, TenantID: 8}
+	assert.ErrorIs(t, psql.Insert(ctx, other), psql.ErrTenantMismatch)
+	assert.ErrorIs(t, psql.Update(ctx, other), psql.ErrTenantMismatch)
+	assert.ErrorIs(t, psql.DeleteObj(ctx, other), psql.ErrTenantMismatch)
+}
+
+func TestTenantUpdateWhereMove(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	ctx = psql.WithTenant(ctx, uint64(7))
+
+	_, err := psql.UpdateWhere[tenantOrder](ctx, map[string]any{"ID": 1}, map[string]any{"TenantID": uint64(8)})
+	assert.ErrorIs(t, err, psql.ErrTenantMismatch)
+	_, err = psql.UpdateWhere[tenantOrder](ctx, nil, map[string]any{"Total": 1, "TenantID": uint64(7)})
+	assert.ErrorIs(t, err, psql.ErrTenantMismatch, "the tenant column is never set")
+	assert.Empty(t, db.Queries())
+}
+
+func TestTenantUpsert(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	ctx = psql.WithTenant(ctx, uint64(7))
+
+	require.NoError(t, psql.Upsert(ctx, &tenantOrder{ID: 1, Total: 5}))
+	assert.Contains(t, db.Last().Query, ` DO UPDATE SET "Total"=EXCLUDED."Total" WHERE "tenant_orders"."TenantID"=EXCLUDED."TenantID"`)
+
+	// the row with ID 1 belongs to another tenant: nothing is updated
+	db.OnExec = func(q string, args []driver.Value) (driver.Result, error) {
+		return fakeAffected(0), nil
+	}
+	assert.ErrorIs(t, psql.Upsert(ctx, &tenantOrder{ID: 1, Total: 5}), psql.ErrTenantMismatch)
+	require.NoError(t, psql.Upsert(ctx, &tenantOrder{ID: 1, Total: 5}, psql.ConflictOn("TenantID", "ID")), "no guard when the tenant is a conflict column")
+
+	db, ctx = fakedb.New(t, psql.EngineMySQL)
+	ctx = psql.WithTenant(ctx, uint64(7))
+	assert.Error(t, psql.Upsert(ctx, &tenantOrder{ID: 1, Total: 5}))
+	assert.Empty(t, db.Queries())
+}
+
+func TestTenantConversion(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	_, err := psql.Fetch[tenantOrder](psql.WithTenant(ctx, int8(3)), nil)
+	assert.NoError(t, err)
+	_, err = psql.Fetch[tenantOrder](psql.WithTenant(ctx, -1), nil)
+	assert.Error(t, err, "negative value for an unsigned field")
+	_, err = psql.Fetch[tenantOrder](psql.WithTenant(ctx, "7"), nil)
+	assert.Error(t, err, "strings are not converted to numbers")
+}
@@ -0,0 +1,127 @@
+package psql
+
+import (
+	"context"
+)
+
+// Attribute keys set on spans by psql. They follow the OpenTelemetry database
+// semantic conventions where one exists.
+const (
+	AttrEngine    = "db.system"          // engine name: mysql, postgresql or sqlite
+	AttrTable     = "db.sql.table"       // table name
+	AttrStatement = "db.statement"       // last SQL statement run in the span
+	AttrOperation = "db.operation"       // operation type, see [OpType.String]
+	AttrRowCount  = "db.psql.rows"       // rows returned or affected
+	AttrTxDepth   = "db.psql.tx.depth"   // transaction depth (0 for the real transaction)
+	AttrTxOutcome = "db.psql.tx.outcome" // "commit" or "rollback"
+	AttrTxLabel   = "db.psql.tx.label"   // label set with [TxOpts]
+	AttrPreload   = "db.psql.preload"    // association being preloaded
+)
+
+// Attr is a key/value attribute attached to a [Span].
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// Tracer creates spans for psql operations. It is a small interface that an
+// adapter for a tracing library (e.g. OpenTelemetry) can implement without
+// psql depending on it. Register one with [WithTracer] or [Backend.SetTracer].
+//
+// Start must return a context carrying the new span so that spans started
+// from it are nested as children.
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...Attr) (context.Context, Span)
+}
+
+// Span is a unit of work created by a [Tracer].
+type Span interface {
+	// SetAttrs adds or replaces attributes on the span.
+	SetAttrs(attrs ...Attr)
+	// End completes the span. err is the outcome of the operation, or nil.
+	End(err error)
+}
+
+// WithTracer sets the [Tracer] used by the backend.
+func WithTracer(t Tracer) BackendOption {
+	return func(b *Backend) {
+		b.tracer = t
+	}
+}
+
+// SetTracer sets the [Tracer] used by the backend. It should be called during
+// setup, before the backend is used concurrently.
+func (be *Backend) SetTracer(t Tracer) {
+	if be == nil {
+		return
+	}
+	be.tracer = t
+}
+
+type ctxSpanKey struct{}
+
+// startSpan starts a span if the backend of ctx has a tracer. The returned span
+// is nil otherwise, and can be passed to endSpan safely.
+func startSpan(ctx context.Context, name string, attrs ...Attr) (context.Context, Span) {
+	be := GetBackend(ctx)
+	if be == nil || be.tracer == nil {
+		return ctx, nil
+	}
+	attrs = append(attrs, Attr{AttrEngine, engineSystem(be.Engine())})
+	ctx, sp := be.tracer.Start(ctx, name, attrs...)
+	if sp == nil {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, ctxSpanKey{}, sp), sp
+}
+
+func endSpan(sp Span, err error) {
+	if sp != nil {
+		sp.End(err)
+	}
+}
+
+// traceStatement records the statement on the innermost psql span of ctx.
+func traceStatement(ctx context.Context, query string) {
+	if sp, ok := ctx.Value(ctxSpanKey{}).(Span); ok {
+		sp.SetAttrs(Attr{AttrStatement, query})
+	}
+}
+
+// traceOp wraps a typed operation in a span.
+func traceOp(ctx context.Context, op *Operation, fn Handler) error {
+	ctx, sp := startSpan(ctx, "psql."+op.Type.String(),
+		Attr{AttrTable, op.Table.TableName()},
+		Attr{AttrOperation, op.Type.String()},
+	)
+	if sp == nil {
+		return fn(ctx, op)
+	}
+	err := fn(ctx, op)
+	switch {
+	case op.Result != nil:
+		if n, err := op.Result.RowsAffected(); err == nil {
+			sp.SetAttrs(Attr{AttrRowCount, n})
+		}
+	case op.Type == OpFetch || op.Type.IsWrite():
+		if op.Objects != nil {
+			sp.SetAttrs(Attr{AttrRowCount, int64(len(op.Objects))})
+		}
+	}
+	sp.End(err)
+	return err
+}
+
+// engineSystem returns the db.system name of an engine.
+func engineSystem(e Engine) string {
+	switch e {
+	case EngineMySQL:
+		return "mysql"
+	case EnginePostgreSQL:
+		return "postgresql"
+	case EngineSQLite:
+		return "sqlite"
+	default:
+		return "other_sql"
+	}
+}
@@ -0,0 +1,72 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/portablesql/psql/tracetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceFetch(t *testing.T) {
+	db, be, ctx := fakedb.NewBackend(t, psql.EnginePostgreSQL)
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{
+			Cols: []string{"ID", "Title"},
+			Data: [][]driver.Value{{"1", "a"}, {"2", "b"}},
+		}, nil
+	}
+	rec := tracetest.NewRecorder()
+	be.SetTracer(rec)
+
+	_, err := psql.Fetch[hookedDoc](ctx, nil)
+	require.NoError(t, err)
+
+	sp, ok := rec.Find("psql.fetch")
+	require.True(t, ok)
+	assert.True(t, sp.Ended)
+	assert.Equal(t, "hooked_docs", sp.Attrs[psql.AttrTable])
+	assert.Equal(t, "postgresql", sp.Attrs[psql.AttrEngine])
+	assert.Equal(t, int64(2), sp.Attrs[psql.AttrRowCount])
+	assert.Contains(t, sp.Attrs[psql.AttrStatement], `FROM "hooked_docs"`)
+}
+
+func TestTraceTxNesting(t *testing.T) {
+	_, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+	rec := tracetest.NewRecorder()
+	be.SetTracer(rec)
+
+	err := psql.Tx(ctx, func(ctx context.Context) error {
+		return psql.Insert(ctx, &hookedDoc{ID: 1})
+	})
+	require.NoError(t, err)
+
+	tx, ok := rec.Find("psql.tx")
+	require.True(t, ok)
+	ins, ok := rec.Find("psql.insert")
+	require.True(t, ok)
+	assert.Equal(t, tx.ID, ins.Parent)
+	assert.Equal(t, "commit", tx.Attrs[psql.AttrTxOutcome])
+	assert.Equal(t, 0, tx.Attrs[psql.AttrTxDepth])
+	assert.True(t, tx.Ended)
+	assert.NoError(t, tx.Err)
+}
+
+func TestTraceTxRollback(t *testing.T) {
+	_, be, ctx := fakedb.NewBackend(t, psql.EngineSQLite)
+	rec := tracetest.NewRecorder()
+	be.SetTracer(rec)
+
+	tx, err := psql.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback())
+
+	sp, ok := rec.Find("psql.tx")
+	require.True(t, ok)
+	assert.Equal(t, "rollback", sp.Attrs[psql.AttrTxOutcome])
+	assert.Len(t, rec.Spans(), 1, "the deferred rollback must not end the span twice")
+}
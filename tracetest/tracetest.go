@@ -0,0 +1,119 @@
+// Package tracetest provides an in-memory [psql.Tracer] recording spans, for
+// use in tests of code using psql and of tracer adapters.
+//
+//	rec := tracetest.NewRecorder()
+//	be.SetTracer(rec)
+//	// ... run operations ...
+//	for _, sp := range rec.Spans() {
+//	    fmt.Println(sp.Name, sp.Attrs[psql.AttrTable])
+//	}
+package tracetest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/portablesql/psql"
+)
+
+// Recorder is a [psql.Tracer] keeping finished spans in memory.
+type Recorder struct {
+	mu    sync.Mutex
+	spans []*Span
+	next  int
+}
+
+// Span is a span recorded by a [Recorder].
+type Span struct {
+	ID       int
+	Parent   int // ID of the parent span, or 0 for a root span
+	Name     string
+	Attrs    map[string]any
+	Err      error
+	Started  time.Time
+	Finished time.Time
+	Ended    bool
+
+	rec *Recorder
+}
+
+type ctxKey struct{}
+
+// NewRecorder returns a new, empty [Recorder].
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Start implements [psql.Tracer].
+func (r *Recorder) Start(ctx context.Context, name string, attrs ...psql.Attr) (context.Context, psql.Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.next += 1
+	sp := &Span{
+		ID:      r.next,
+		Name:    name,
+		Attrs:   make(map[string]any),
+		Started: time.Now(),
+		rec:     r,
+	}
+	if parent, ok := ctx.Value(ctxKey{}).(*Span); ok {
+		sp.Parent = parent.ID
+	}
+	for _, a := range attrs {
+		sp.Attrs[a.Key] = a.Value
+	}
+	r.spans = append(r.spans, sp)
+	return context.WithValue(ctx, ctxKey{}, sp), sp
+}
+
+// SetAttrs implements [psql.Span].
+func (s *Span) SetAttrs(attrs ...psql.Attr) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	for _, a := range attrs {
+		s.Attrs[a.Key] = a.Value
+	}
+}
+
+// End implements [psql.Span].
+func (s *Span) End(err error) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+	s.Err = err
+	s.Finished = time.Now()
+	s.Ended = true
+}
+
+// Spans returns a copy of all spans started so far, in start order.
+func (r *Recorder) Spans() []Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]Span, len(r.spans))
+	for n, sp := range r.spans {
+		res[n] = *sp
+		res[n].Attrs = make(map[string]any, len(sp.Attrs))
+		for k, v := range sp.Attrs {
+			res[n].Attrs[k] = v
+		}
+	}
+	return res
+}
+
+// Find returns the first span with the given name.
+func (r *Recorder) Find(name string) (Span, bool) {
+	for _, sp := range r.Spans() {
+		if sp.Name == name {
+			return sp, true
+		}
+	}
+	return Span{}, false
+}
+
+// Reset drops all recorded spans.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = nil
+}
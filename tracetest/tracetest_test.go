@@ -0,0 +1,38 @@
+package tracetest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/tracetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorderNesting(t *testing.T) {
+	rec := tracetest.NewRecorder()
+
+	ctx, parent := rec.Start(context.Background(), "parent", psql.Attr{Key: "a", Value: 1})
+	_, child := rec.Start(ctx, "child")
+	child.SetAttrs(psql.Attr{Key: "b", Value: 2})
+	child.End(errors.New("fail"))
+	parent.End(nil)
+
+	spans := rec.Spans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, 0, spans[0].Parent)
+	assert.Equal(t, spans[0].ID, spans[1].Parent)
+	assert.Equal(t, 1, spans[0].Attrs["a"])
+	assert.Equal(t, 2, spans[1].Attrs["b"])
+	assert.EqualError(t, spans[1].Err, "fail")
+	assert.True(t, spans[0].Ended)
+
+	sp, ok := rec.Find("child")
+	assert.True(t, ok)
+	assert.Equal(t, "child", sp.Name)
+
+	rec.Reset()
+	assert.Empty(t, rec.Spans())
+}
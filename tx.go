@@ -18,16 +18,22 @@ type TxProxy struct {
 	ctrl  *txController
 	depth int
 	once  uint64
+	span  Span // tracing span, ended on commit or rollback
 }
 
 type txController struct {
 	depth int
 	lk    sync.Mutex
 	tx    *sql.Tx
+	opts  TxOpts       // options the real transaction was started with
+	cbs   []txCallback // AfterCommit / AfterRollback callbacks
+
+	sharded *ShardedBackend // set if started on a sharded backend
+	shard   *Backend        // shard of the transaction, if sharded is set
 }
 
 func (t *TxProxy) BeginTx(ctx context.Context, opts *sql.TxOptions) (*TxProxy, error) {
-	return t.ctrl.beginSubTx(ctx, opts)
+	return t.ctrl.beginSubTx(ctx, txOptsFromSQL(opts))
 }
 
 func newTxCtrl(tx *sql.Tx, err error) (*TxProxy, error) {
@@ -46,7 +52,7 @@ func newTxCtrl(tx *sql.Tx, err error) (*TxProxy, error) {
 	return res, nil
 }
 
-func (c *txController) beginSubTx(ctx context.Context, opts *sql.TxOptions) (*TxProxy, error) {
+func (c *txController) beginSubTx(ctx context.Context, opts *TxOpts) (*TxProxy, error) {
 	c.lk.Lock()
 	defer c.lk.Unlock()
 
@@ -70,25 +76,37 @@ func (tx *TxProxy) Commit() error {
 		return ErrTxAlreadyProcessed
 	}
 
-	return tx.ctrl.commit(tx.depth)
+	run, err := tx.ctrl.commit(tx.depth)
+	tx.endSpan("commit", err)
+	runTxCallbacks(run)
+	return err
 }
 
-func (c *txController) commit(depth int) error {
+// commit releases the savepoint at depth, or commits the real transaction.
+// It returns the callbacks to run once the lock is released.
+func (c *txController) commit(depth int) ([]txCallback, error) {
 	c.lk.Lock()
 	defer c.lk.Unlock()
 
 	if c.depth != depth {
 		// bad sequence
-		return fmt.Errorf("invalid depth in committed transaction, expected %d but got %d", c.depth, depth)
+		return nil, fmt.Errorf("invalid depth in committed transaction, expected %d but got %d", c.depth, depth)
 	}
 
 	if c.depth > 0 {
+		// callbacks now belong to the enclosing transaction
+		for i := range c.cbs {
+			if c.cbs[i].depth == c.depth {
+				c.cbs[i].depth -= 1
+			}
+		}
 		c.depth -= 1
-		return nil
+		return nil, nil
 	}
 
 	// actually commit
-	return c.tx.Commit()
+	err := c.tx.Commit()
+	return c.takeCallbacks(0, err == nil), err
 }
 
 func (tx *TxProxy) Rollback() error {
@@ -96,24 +114,37 @@ func (tx *TxProxy) Rollback() error {
 		return ErrTxAlreadyProcessed
 	}
 
-	return tx.ctrl.rollback(tx.depth)
+	run, err := tx.ctrl.rollback(tx.depth)
+	tx.endSpan("rollback", err)
+	runTxCallbacks(run)
+	return err
+}
+
+func (tx *TxProxy) endSpan(outcome string, err error) {
+	if tx.span != nil {
+		tx.span.SetAttrs(Attr{AttrTxOutcome, outcome})
+		tx.span.End(err)
+	}
 }
 
-func (c *txController) rollback(depth int) error {
+// rollback rolls back to the savepoint at depth, or the real transaction. It
+// returns the callbacks to run once the lock is released.
+func (c *txController) rollback(depth int) ([]txCallback, error) {
 	c.lk.Lock()
 	defer c.lk.Unlock()
 
 	if c.depth != depth {
 		// bad sequence
-		return fmt.Errorf("invalid depth in committed transaction, expected %d but got %d", c.depth, depth)
+		return nil, fmt.Errorf("invalid depth in committed transaction, expected %d but got %d", c.depth, depth)
 	}
 
 	if c.depth > 0 {
 		_, err := c.tx.Exec(fmt.Sprintf("ROLLBACK TO L%d", c.depth))
+		run := c.takeCallbacks(c.depth, false)
 		c.depth -= 1
-		return err
+		return run, err
 	}
 
 	// full rollback
-	return c.tx.Rollback()
+	return c.takeCallbacks(0, false), c.tx.Rollback()
 }
@@ -0,0 +1,131 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+)
+
+// txCallback is a function registered with [AfterCommit] or [AfterRollback].
+type txCallback struct {
+	depth  int  // depth of the transaction it was registered in
+	commit bool // true for AfterCommit, false for AfterRollback
+	key    any  // set by afterCommitOnce
+	ctx    context.Context
+	fn     func(ctx context.Context)
+}
+
+// AfterCommit registers fn to run once the transaction of ctx is committed.
+// This is the place to publish events or invalidate caches, which must not
+// happen if the transaction is rolled back.
+//
+// fn only runs when the outermost transaction commits. If it is registered in
+// a nested transaction (savepoint) that is rolled back, fn is discarded, even
+// if the outer transaction commits. Outside of a transaction, fn runs
+// immediately.
+//
+// fn receives a context outside of any transaction, derived from ctx.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	tx := txFromContext(ctx)
+	if tx == nil {
+		fn(ctx)
+		return
+	}
+	tx.ctrl.register(txCallback{depth: tx.depth, commit: true, ctx: ctx, fn: fn})
+}
+
+// afterCommitOnce is like [AfterCommit], but does nothing when a callback
+// registered with the same key already runs on the commit of ctx's
+// transaction, that is one registered at the same depth or above.
+func afterCommitOnce(ctx context.Context, key any, fn func(ctx context.Context)) {
+	tx := txFromContext(ctx)
+	if tx == nil {
+		fn(ctx)
+		return
+	}
+	c := tx.ctrl
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	for _, cb := range c.cbs {
+		if cb.commit && cb.key == key && cb.depth <= tx.depth {
+			return
+		}
+	}
+	c.cbs = append(c.cbs, txCallback{depth: tx.depth, commit: true, key: key, ctx: ctx, fn: fn})
+}
+
+// AfterRollback registers fn to run if the work of ctx's transaction is
+// rolled back: when the outermost transaction is rolled back (or fails to
+// commit), or when the nested transaction (savepoint) fn was registered in is
+// rolled back. fn is discarded when the outermost transaction commits, and
+// outside of a transaction, since there is nothing to roll back.
+//
+// fn receives a context outside of any transaction, derived from ctx.
+func AfterRollback(ctx context.Context, fn func(ctx context.Context)) {
+	tx := txFromContext(ctx)
+	if tx == nil {
+		return
+	}
+	tx.ctrl.register(txCallback{depth: tx.depth, ctx: ctx, fn: fn})
+}
+
+func (c *txController) register(cb txCallback) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.cbs = append(c.cbs, cb)
+}
+
+// takeCallbacks removes the callbacks registered at depth or deeper, and
+// returns those to run given the outcome. Must be called with c.lk held.
+func (c *txController) takeCallbacks(depth int, committed bool) []txCallback {
+	var run []txCallback
+	keep := c.cbs[:0]
+	for _, cb := range c.cbs {
+		switch {
+		case cb.depth < depth:
+			keep = append(keep, cb)
+		case cb.commit == committed:
+			run = append(run, cb)
+		}
+	}
+	c.cbs = keep
+	return run
+}
+
+func runTxCallbacks(cbs []txCallback) {
+	for _, cb := range cbs {
+		cb.fn(escapeAllTx(cb.ctx))
+	}
+}
+
+// txFromContext returns the innermost transaction of ctx, if any.
+func txFromContext(ctx context.Context) *TxProxy {
+	for {
+		obj := ctx.Value(ctxValueObjFetch)
+		if obj == nil {
+			return nil
+		}
+		objV := obj.(*ctxValueObj)
+		if tx, ok := objV.obj.(*TxProxy); ok {
+			return tx
+		}
+		ctx = objV.Context
+	}
+}
+
+// escapeAllTx returns the context from before the outermost transaction of
+// ctx was attached, or ctx if it has none.
+func escapeAllTx(ctx context.Context) context.Context {
+	res := ctx
+	for {
+		obj := ctx.Value(ctxValueObjFetch)
+		if obj == nil {
+			return res
+		}
+		objV := obj.(*ctxValueObj)
+		switch objV.obj.(type) {
+		case *TxProxy, *sql.Tx:
+			res = objV.Context
+		}
+		ctx = objV.Context
+	}
+}
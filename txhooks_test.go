@@ -0,0 +1,80 @@
+package psql_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAfterCommit(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	var events []string
+	err := psql.Tx(ctx, func(ctx context.Context) error {
+		psql.AfterCommit(ctx, func(ctx context.Context) {
+			events = append(events, "commit")
+			err := psql.Q("SELECT 1").Exec(ctx)
+			assert.NoError(t, err, "the callback context is outside the transaction")
+		})
+		psql.AfterRollback(ctx, func(ctx context.Context) { events = append(events, "rollback") })
+		assert.Empty(t, events)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"commit"}, events)
+	assert.Equal(t, "SELECT 1", db.Last().Query)
+
+	// outside of a transaction
+	events = nil
+	psql.AfterCommit(ctx, func(ctx context.Context) { events = append(events, "commit") })
+	psql.AfterRollback(ctx, func(ctx context.Context) { events = append(events, "rollback") })
+	assert.Equal(t, []string{"commit"}, events)
+}
+
+func TestAfterRollback(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	var events []string
+	boom := errors.New("boom")
+	err := psql.Tx(ctx, func(ctx context.Context) error {
+		psql.AfterCommit(ctx, func(ctx context.Context) { events = append(events, "commit") })
+		psql.AfterRollback(ctx, func(ctx context.Context) { events = append(events, "rollback") })
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+	assert.Equal(t, []string{"rollback"}, events)
+}
+
+func TestAfterCommitSavepoint(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	var events []string
+	add := func(name string) func(context.Context) {
+		return func(context.Context) { events = append(events, name) }
+	}
+	err := psql.Tx(ctx, func(ctx context.Context) error {
+		psql.AfterCommit(ctx, add("outer"))
+
+		// released savepoint: callbacks move to the outer transaction
+		require.NoError(t, psql.Tx(ctx, func(ctx context.Context) error {
+			psql.AfterCommit(ctx, add("released"))
+			return nil
+		}))
+
+		// rolled back savepoint: commit callbacks are discarded
+		_ = psql.Tx(ctx, func(ctx context.Context) error {
+			psql.AfterCommit(ctx, add("discarded"))
+			psql.AfterRollback(ctx, add("savepoint rollback"))
+			return errors.New("undo")
+		})
+		assert.Equal(t, []string{"savepoint rollback"}, events)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"savepoint rollback", "outer", "released"}, events)
+}
@@ -0,0 +1,130 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// TxOpts configures a transaction started with [TxWith].
+type TxOpts struct {
+	Isolation sql.IsolationLevel // isolation level, sql.LevelDefault for the engine default
+	ReadOnly  bool               // start a read-only transaction
+	Timeout   time.Duration      // if set, the transaction is rolled back once it runs longer
+	Label     string             // name reported on the transaction's tracing span
+}
+
+// TxWith runs cb inside a SQL transaction started with the given options, like
+// [Tx]. When Timeout is set, the context passed to cb is cancelled after that
+// duration, which rolls back the transaction.
+//
+// When ctx already carries a transaction, a savepoint is created as with
+// [Tx], which cannot change the options of the outer transaction: asking for
+// an isolation level stronger than the one of the outer transaction (or any
+// explicit level when the outer transaction uses the engine default),
+// ReadOnly in a read-write transaction, or a Timeout ending before ctx's
+// deadline, returns [ErrTxIncompatible] without calling cb.
+//
+// Engine-specific options are applied by dialects implementing [TxStarter];
+// otherwise Isolation and ReadOnly are passed to the driver as sql.TxOptions.
+func TxWith(ctx context.Context, opts TxOpts, cb func(ctx context.Context) error) error {
+	if outer, ok := ctx.Value(ctxDataObj).(*TxProxy); ok {
+		if err := outer.ctrl.opts.allows(ctx, opts); err != nil {
+			return err
+		}
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	ctx, tx, err := beginTx(ctx, &opts)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ctx = ContextTx(ctx, tx)
+	err = cb(ctx)
+	if err == nil {
+		return tx.Commit()
+	}
+	return err
+}
+
+// LockForWrite takes the write lock of the database holding T at the start of
+// the transaction of ctx, like BEGIN IMMEDIATE, so that transactions reading
+// rows they then update wait for each other instead of failing to upgrade
+// their lock. This is only needed on SQLite, which has no row locks: it runs
+// a no-op UPDATE of T's table. On other engines it does nothing, as rows read
+// with FOR UPDATE are locked already.
+func LockForWrite[T any](ctx context.Context) error {
+	be := GetBackend(ctx)
+	if be.Engine() != EngineSQLite {
+		return nil
+	}
+	t := Table[T]()
+	if t.mainKey == nil {
+		return fmt.Errorf("cannot lock %s without a unique key", t.table)
+	}
+	col := QuoteName(t.mainKey.Fields[0])
+	_, err := ExecContext(ctx, "UPDATE "+QuoteName(t.FormattedName(be))+" SET "+col+"="+col+" WHERE 1=0")
+	return err
+}
+
+// allows checks whether a transaction nested in one started with o can use
+// opts. A nested Timeout is only allowed if ctx ends first anyway, as
+// rolling back the savepoint would not end the outer transaction.
+func (o TxOpts) allows(ctx context.Context, opts TxOpts) error {
+	if opts.Isolation != sql.LevelDefault && opts.Isolation > o.Isolation {
+		return fmt.Errorf("%w: isolation %s requested inside a transaction using %s", ErrTxIncompatible, opts.Isolation, o.Isolation)
+	}
+	if opts.ReadOnly && !o.ReadOnly {
+		return fmt.Errorf("%w: read-only requested inside a read-write transaction", ErrTxIncompatible)
+	}
+	if opts.Timeout > 0 {
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > opts.Timeout {
+			return fmt.Errorf("%w: timeout of %s requested inside a transaction without an earlier deadline", ErrTxIncompatible, opts.Timeout)
+		}
+	}
+	return nil
+}
+
+// sqlOptions returns the options passed to the driver, nil if none are set.
+func (o TxOpts) sqlOptions() *sql.TxOptions {
+	if o.Isolation == sql.LevelDefault && !o.ReadOnly {
+		return nil
+	}
+	return &sql.TxOptions{Isolation: o.Isolation, ReadOnly: o.ReadOnly}
+}
+
+func txOptsFromSQL(opts *sql.TxOptions) *TxOpts {
+	if opts == nil {
+		return nil
+	}
+	return &TxOpts{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+}
+
+// startTx starts a real transaction on db.
+func startTx(ctx context.Context, db TxBeginner, opts *TxOpts) (*TxProxy, error) {
+	var o TxOpts
+	if opts != nil {
+		o = *opts
+	}
+
+	var tx *sql.Tx
+	var err error
+	if ts, ok := GetBackend(ctx).Engine().dialect().(TxStarter); ok {
+		tx, err = ts.StartTx(ctx, db, o)
+	} else {
+		tx, err = db.BeginTx(ctx, o.sqlOptions())
+	}
+	res, err := newTxCtrl(tx, err)
+	if err != nil {
+		return nil, err
+	}
+	res.ctrl.opts = o
+	return res, nil
+}
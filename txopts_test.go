@@ -0,0 +1,136 @@
+package psql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxWithOptions(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	err := psql.TxWith(ctx, psql.TxOpts{Isolation: sql.LevelSerializable, ReadOnly: true}, func(ctx context.Context) error {
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, db.TxOpts(), 1)
+	assert.Equal(t, driver.IsolationLevel(sql.LevelSerializable), db.TxOpts()[0].Isolation)
+	assert.True(t, db.TxOpts()[0].ReadOnly)
+	assert.Equal(t, "COMMIT", db.Last().Query)
+}
+
+func TestTxWithNested(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	err := psql.TxWith(ctx, psql.TxOpts{Isolation: sql.LevelReadCommitted}, func(ctx context.Context) error {
+		called := false
+		err := psql.TxWith(ctx, psql.TxOpts{Isolation: sql.LevelSerializable}, func(ctx context.Context) error {
+			called = true
+			return nil
+		})
+		assert.ErrorIs(t, err, psql.ErrTxIncompatible)
+		assert.False(t, called)
+
+		// same or weaker levels run in a savepoint
+		return psql.TxWith(ctx, psql.TxOpts{Isolation: sql.LevelReadUncommitted}, func(ctx context.Context) error {
+			return nil
+		})
+	})
+	require.NoError(t, err)
+	_, ok := db.Find("SAVEPOINT")
+	assert.True(t, ok)
+
+	// explicit level inside a transaction using the engine default
+	err = psql.Tx(ctx, func(ctx context.Context) error {
+		return psql.TxWith(ctx, psql.TxOpts{Isolation: sql.LevelRepeatableRead}, func(ctx context.Context) error {
+			return nil
+		})
+	})
+	assert.ErrorIs(t, err, psql.ErrTxIncompatible)
+
+	// read-only inside a read-write transaction
+	err = psql.Tx(ctx, func(ctx context.Context) error {
+		return psql.TxWith(ctx, psql.TxOpts{ReadOnly: true}, func(ctx context.Context) error {
+			return nil
+		})
+	})
+	assert.ErrorIs(t, err, psql.ErrTxIncompatible)
+	require.NoError(t, psql.TxWith(ctx, psql.TxOpts{ReadOnly: true}, func(ctx context.Context) error {
+		return psql.TxWith(ctx, psql.TxOpts{ReadOnly: true}, func(ctx context.Context) error {
+			return nil
+		})
+	}))
+}
+
+func TestTxWithNestedTimeout(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	nested := func(timeout time.Duration) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			return psql.TxWith(ctx, psql.TxOpts{Timeout: timeout}, func(ctx context.Context) error {
+				return nil
+			})
+		}
+	}
+	assert.ErrorIs(t, psql.Tx(ctx, nested(time.Second)), psql.ErrTxIncompatible, "the outer transaction has no deadline")
+	assert.ErrorIs(t, psql.TxWith(ctx, psql.TxOpts{Timeout: time.Second}, nested(time.Millisecond)), psql.ErrTxIncompatible, "the outer transaction ends later")
+	assert.NoError(t, psql.TxWith(ctx, psql.TxOpts{Timeout: time.Second}, nested(time.Minute)), "the outer transaction ends first")
+}
+
+func TestTxWithTimeout(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	err := psql.TxWith(ctx, psql.TxOpts{Timeout: time.Millisecond}, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// txStarterDialect applies transaction options itself.
+type txStarterDialect struct {
+	testSqliteDialect
+	started []psql.TxOpts
+}
+
+func (d *txStarterDialect) StartTx(ctx context.Context, db psql.TxBeginner, opts psql.TxOpts) (*sql.Tx, error) {
+	d.started = append(d.started, opts)
+	return db.BeginTx(ctx, nil)
+}
+
+func TestTxWithDialectStarter(t *testing.T) {
+	engine := psql.Engine(100)
+	d := &txStarterDialect{}
+	psql.RegisterDialect(engine, d)
+
+	db, ctx := fakedb.New(t, engine)
+	err := psql.TxWith(ctx, psql.TxOpts{ReadOnly: true, Label: "report"}, func(ctx context.Context) error {
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, d.started, 1)
+	assert.True(t, d.started[0].ReadOnly)
+	assert.Equal(t, "report", d.started[0].Label)
+	assert.False(t, db.TxOpts()[0].ReadOnly, "options are left to the dialect")
+}
+
+func TestLockForWrite(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	require.NoError(t, psql.Tx(ctx, func(ctx context.Context) error {
+		return psql.LockForWrite[versionedDoc](ctx)
+	}))
+	q := db.Queries()
+	require.Len(t, q, 3)
+	assert.Equal(t, `UPDATE "versioned_docs" SET "ID"="ID" WHERE 1=0`, q[1].Query)
+
+	db, ctx = fakedb.New(t, psql.EnginePostgreSQL)
+	require.NoError(t, psql.LockForWrite[versionedDoc](ctx))
+	assert.Empty(t, db.Queries(), "only SQLite needs a write to lock")
+}
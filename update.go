@@ -2,8 +2,10 @@ package psql
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
 	"errors"
+	"fmt"
+	"log/slog"
 	"reflect"
 )
 
@@ -11,6 +13,14 @@ import (
 // since the last load are updated (if the object was previously fetched). Fires
 // [BeforeSaveHook], [BeforeUpdateHook], [AfterUpdateHook], and [AfterSaveHook] if
 // implemented. All passed objects must be of the same type.
+//
+// If the table has a field tagged with the version attribute, the update only
+// applies when the stored version matches the object's, and the version is
+// bumped on success. [ErrStaleObject] is returned when the row was modified
+// concurrently.
+//
+// Auto-update timestamp fields (UpdatedAt, or tagged autoUpdateTime) are set
+// to the current time whenever at least one other column changed.
 func Update[T any](ctx context.Context, target ...*T) error {
 	if len(target) == 0 {
 		return nil
@@ -19,12 +29,54 @@ func Update[T any](ctx context.Context, target ...*T) error {
 	return Table[T]().Update(ctx, target...)
 }
 
+// UpdateFields writes only the named fields of target, locating the record by
+// its main key. Fields can be given by Go field name or column name. Unlike
+// [Update], the row state is not used to decide which columns to write, which
+// makes it suitable for objects that were not fetched from the database.
+//
+//	order.Status = "shipped"
+//	err := psql.UpdateFields(ctx, order, "Status")
+//
+// Hooks and optimistic locking behave as with [Update]. The auto-update
+// timestamp is refreshed, unless it is named, in which case its value is
+// written as-is.
+func UpdateFields[T any](ctx context.Context, target *T, fields ...string) error {
+	return Table[T]().UpdateFields(ctx, target, fields...)
+}
+
+// UpdateWhere performs a set-based UPDATE on all records matching where. Keys
+// of fields can be Go field names or column names, and values may be plain
+// values or SET expressions such as [Incr], [Decr] or [SetRaw]:
+//
+//	res, err := psql.UpdateWhere[Product](ctx, map[string]any{"Category": "books"},
+//	    map[string]any{"Stock": psql.Decr(1)})
+//
+// Soft-deleted records are left untouched unless [IncludeDeleted] is passed.
+// Auto-update timestamps are refreshed and version columns bumped unless set
+// explicitly in fields.
+func UpdateWhere[T any](ctx context.Context, where any, fields map[string]any, opts ...*FetchOptions) (sql.Result, error) {
+	return Table[T]().UpdateWhere(ctx, where, fields, opts...)
+}
+
 type updatedField struct {
 	f *StructField
 	v any
 }
 
 func (t *TableMeta[T]) Update(ctx context.Context, target ...*T) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	return t.runOp(ctx, &Operation{Type: OpUpdate, Objects: objectsOf(target)}, func(ctx context.Context, op *Operation) error {
+		targets, err := opTargets[T](op)
+		if err != nil {
+			return err
+		}
+		return t.update(ctx, targets...)
+	})
+}
+
+func (t *TableMeta[T]) update(ctx context.Context, target ...*T) error {
 	if t == nil {
 		return ErrNotReady
 	}
@@ -33,119 +85,334 @@ func (t *TableMeta[T]) Update(ctx context.Context, target ...*T) error {
 		return errors.New("cannot update values without a unique key")
 	}
 
-	be := GetBackend(ctx)
-	engine := be.Engine()
-
 	for _, obj := range target {
-		if h, ok := any(obj).(BeforeSaveHook); ok {
-			if err := h.BeforeSave(ctx); err != nil {
-				return err
-			}
+		if err := t.updateObj(ctx, obj, nil); err != nil {
+			return err
 		}
-		if h, ok := any(obj).(BeforeUpdateHook); ok {
-			if err := h.BeforeUpdate(ctx); err != nil {
+	}
+	return nil
+}
+
+func (t *TableMeta[T]) UpdateFields(ctx context.Context, target *T, fields ...string) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	return t.runOp(ctx, &Operation{Type: OpUpdate, Objects: []any{target}}, func(ctx context.Context, op *Operation) error {
+		targets, err := opTargets[T](op)
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			if err := t.updateFields(ctx, target, fields...); err != nil {
 				return err
 			}
 		}
+		return nil
+	})
+}
+
+func (t *TableMeta[T]) updateFields(ctx context.Context, target *T, fields ...string) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	t.check(ctx)
+	if t.mainKey == nil {
+		return errors.New("cannot update values without a unique key")
+	}
+	if target == nil {
+		return errors.New("UpdateFields requires a non-nil target")
+	}
+
+	only := make([]*StructField, 0, len(fields))
+	for _, name := range fields {
+		f := findFieldByNameOrCol(t.fldcol, name)
+		if f == nil {
+			return fmt.Errorf("unknown field %q on table %s", name, t.table)
+		}
+		only = append(only, f)
+	}
+	if len(only) == 0 {
+		return nil
+	}
+
+	return t.updateObj(ctx, target, only)
+}
+
+// updateObj updates a single object. If only is nil, the columns to write are
+// computed from the row state, otherwise exactly the given fields are written.
+func (t *TableMeta[T]) updateObj(ctx context.Context, obj *T, only []*StructField) error {
+	be := GetBackend(ctx)
+	engine := be.Engine()
+
+	if h, ok := any(obj).(BeforeSaveHook); ok {
+		if err := h.BeforeSave(ctx); err != nil {
+			return err
+		}
+	}
+	if h, ok := any(obj).(BeforeUpdateHook); ok {
+		if err := h.BeforeUpdate(ctx); err != nil {
+			return err
+		}
+	}
 
-		// check for changed values
-		upd := make(map[string]*updatedField)
-		allvals := make(map[string]any)
+	// check for changed values
+	upd := make(map[string]*updatedField)
+	allvals := make(map[string]any)
 
-		val := reflect.ValueOf(obj).Elem()
+	val := reflect.ValueOf(obj).Elem()
 
-		st := t.rowstate(obj)
-		if st == nil || !st.init {
-			// we don't have a state → update everything
-			for _, f := range t.fields {
-				v := val.Field(f.Index).Interface()
-				upd[f.Column] = &updatedField{f: f, v: v}
-				allvals[f.Column] = v
+	st := t.rowstate(obj)
+	switch {
+	case only != nil:
+		for _, f := range only {
+			if f == t.version {
+				continue
 			}
-		} else {
-			for _, f := range t.fields {
-				// grab state value
-				stv, ok := st.val[f.Column]
-				newv := val.Field(f.Index).Interface()
-				allvals[f.Column] = newv
-
-				if !ok {
-					// no value in state → just force update
-					upd[f.Column] = &updatedField{f: f, v: newv}
-					continue
-				}
-				if f.Attrs["format"] == "json" {
-					// State stores raw JSON string; compare by re-marshaling
-					newJSON, _ := json.Marshal(newv)
-					if string(newJSON) != stv {
-						upd[f.Column] = &updatedField{f: f, v: newv}
-					}
-				} else if !reflect.DeepEqual(newv, stv) {
-					upd[f.Column] = &updatedField{f: f, v: newv}
-				}
+			upd[f.Column] = &updatedField{f: f, v: val.Field(f.Index).Interface()}
+		}
+	case st == nil || !st.init:
+		// we don't have a state → update everything
+		for _, f := range t.fields {
+			v := val.Field(f.Index).Interface()
+			allvals[f.Column] = v
+			if f == t.version {
+				// version is bumped below, never written as-is
+				continue
 			}
+			upd[f.Column] = &updatedField{f: f, v: v}
 		}
-		if len(upd) == 0 {
-			// no update needed
-			continue
+	default:
+		for _, f := range t.fields {
+			// grab state value
+			stv, ok := st.val[f.Column]
+			newv := val.Field(f.Index).Interface()
+			allvals[f.Column] = newv
+
+			if f == t.version {
+				continue
+			}
+			if !ok {
+				// no value in state → just force update
+				upd[f.Column] = &updatedField{f: f, v: newv}
+				continue
+			}
+			if fieldChanged(f, stv, newv) {
+				upd[f.Column] = &updatedField{f: f, v: newv}
+			}
 		}
+	}
 
-		// perform update
-		// Get the formatted table name (respects explicit names)
-		tableName := t.FormattedName(be)
+	if t.updatedAt != nil {
+		// refresh UpdatedAt if anything else changed, unless it was
+		// explicitly modified or listed
+		_, explicit := upd[t.updatedAt.Column]
+		others := len(upd)
+		if explicit {
+			others -= 1
+		}
+		if others > 0 && (!explicit || (only == nil && (st == nil || !st.init))) {
+			v := t.touchUpdate(be, val)
+			upd[t.updatedAt.Column] = &updatedField{f: t.updatedAt, v: v}
+			allvals[t.updatedAt.Column] = v
+		}
+	}
 
-		d := engine.dialect()
-		req := "UPDATE " + QuoteName(tableName) + " SET "
-		var flds []any
-		first := true
+	if len(upd) == 0 {
+		// no update needed
+		return nil
+	}
+
+	// optimistic locking: only update the row if its version still
+	// matches the one we hold, and bump it at the same time
+	var curVersion, nextVersion reflect.Value
+	if t.version != nil {
+		curVersion = val.Field(t.version.Index)
+		nextVersion = t.nextVersion(be, curVersion)
+		upd[t.version.Column] = &updatedField{f: t.version, v: nextVersion.Interface()}
+	}
+
+	// perform update
+	// Get the formatted table name (respects explicit names)
+	tableName := t.FormattedName(be)
+
+	d := engine.dialect()
+	req := "UPDATE " + QuoteName(tableName) + " SET "
+	var flds []any
+	first := true
+	for k, v := range upd {
+		if !first {
+			req += ", "
+		} else {
+			first = false
+		}
+		flds = append(flds, engine.export(v.v, v.f))
+		req += QuoteName(k) + " = " + d.Placeholder(len(flds))
+	}
+	req += " WHERE "
+	first = true
+	// render key
+	for _, col := range t.mainKey.Fields {
+		if !first {
+			req += " AND "
+		} else {
+			first = false
+		}
+		flds = append(flds, engine.export(val.Field(t.fldcol[col].Index).Interface(), t.fldcol[col]))
+		req += QuoteName(col) + " = " + d.Placeholder(len(flds))
+	}
+	if t.version != nil {
+		flds = append(flds, engine.export(curVersion.Interface(), t.version))
+		req += " AND " + QuoteName(t.version.Column) + " = " + d.Placeholder(len(flds))
+	}
+	if t.tenant != nil {
+		flds = append(flds, engine.export(val.Field(t.tenant.Index).Interface(), t.tenant))
+		req += " AND " + QuoteName(t.tenant.Column) + " = " + d.Placeholder(len(flds))
+	}
+
+	res, err := ExecContext(ctx, req, flds...)
+	if err != nil {
+		return err
+	}
+	if t.version != nil {
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return t.staleError()
+		}
+		curVersion.Set(nextVersion)
+		allvals[t.version.Column] = nextVersion.Interface()
+	}
+	if t.history {
+		cols := make([]string, 0, len(upd))
+		newVals := make(map[string]any, len(upd))
 		for k, v := range upd {
-			if !first {
-				req += ", "
-			} else {
-				first = false
+			cols = append(cols, k)
+			newVals[k] = v.v
+		}
+		if err := t.recordHistory(ctx, "update", val, t.stateValues(st, cols), newVals); err != nil {
+			return err
+		}
+	}
+	if st != nil {
+		if st.init {
+			// update state since update was successful
+			for k, v := range upd {
+				st.val[k] = stateValue(v.f, v.v)
 			}
-			flds = append(flds, engine.export(v.v, v.f))
-			req += QuoteName(k) + " = " + d.Placeholder(len(flds))
-		}
-		req += " WHERE "
-		first = true
-		// render key
-		for _, col := range t.mainKey.Fields {
-			if !first {
-				req += " AND "
-			} else {
-				first = false
+		} else if only == nil {
+			st.init = true
+			st.val = make(map[string]any, len(allvals))
+			for k, v := range allvals {
+				st.val[k] = stateValue(t.fldcol[k], v)
 			}
-			flds = append(flds, engine.export(val.Field(t.fldcol[col].Index).Interface(), t.fldcol[col]))
-			req += QuoteName(col) + " = " + d.Placeholder(len(flds))
 		}
+	}
 
-		_, err := ExecContext(ctx, req, flds...)
-		if err != nil {
+	if h, ok := any(obj).(AfterUpdateHook); ok {
+		if err := h.AfterUpdate(ctx); err != nil {
 			return err
 		}
-		if st != nil {
-			if st.init {
-				// update state since update was successful
-				for k, v := range upd {
-					st.val[k] = v.v
-				}
-			} else {
-				st.init = true
-				st.val = allvals
-			}
+	}
+	if h, ok := any(obj).(AfterSaveHook); ok {
+		if err := h.AfterSave(ctx); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if h, ok := any(obj).(AfterUpdateHook); ok {
-			if err := h.AfterUpdate(ctx); err != nil {
-				return err
+func (t *TableMeta[T]) UpdateWhere(ctx context.Context, where any, fields map[string]any, opts ...*FetchOptions) (sql.Result, error) {
+	if t == nil {
+		return nil, ErrNotReady
+	}
+	op := &Operation{Type: OpUpdateWhere, Where: where, Values: fields, Options: resolveFetchOpts(opts)}
+	err := t.runOp(ctx, op, func(ctx context.Context, op *Operation) error {
+		var err error
+		op.Result, err = t.updateWhere(ctx, op.Where, op.Values, op.Options)
+		return err
+	})
+	return op.Result, err
+}
+
+func (t *TableMeta[T]) updateWhere(ctx context.Context, where any, fields map[string]any, opts ...*FetchOptions) (sql.Result, error) {
+	if t == nil {
+		return nil, ErrNotReady
+	}
+	t.check(ctx)
+	opt := resolveFetchOpts(opts)
+	if len(fields) == 0 {
+		return nil, errors.New("UpdateWhere requires at least one field to set")
+	}
+
+	be := GetBackend(ctx)
+	engine := be.Engine()
+
+	set := make(map[string]any, len(fields)+2)
+	for name, v := range fields {
+		f := findFieldByNameOrCol(t.fldcol, name)
+		if f == nil {
+			return nil, fmt.Errorf("unknown field %q on table %s", name, t.table)
+		}
+		if f == t.tenant {
+			// would move the rows to another tenant
+			return nil, fmt.Errorf("%w: %s cannot be set on %s", ErrTenantMismatch, f.Name, t.table)
+		}
+		if f.Attrs["format"] == "json" {
+			switch v.(type) {
+			case *SetRaw, EscapeValueable:
+			default:
+				v = engine.export(v, f)
 			}
 		}
-		if h, ok := any(obj).(AfterSaveHook); ok {
-			if err := h.AfterSave(ctx); err != nil {
-				return err
+		set[f.Column] = v
+	}
+	if t.updatedAt != nil {
+		if _, ok := set[t.updatedAt.Column]; !ok {
+			set[t.updatedAt.Column] = t.updatedAt.now(be)
+		}
+	}
+	if t.version != nil {
+		if _, ok := set[t.version.Column]; !ok {
+			if t.typ.Field(t.version.Index).Type == timeType {
+				set[t.version.Column] = t.version.now(be)
+			} else {
+				set[t.version.Column] = Incr(1)
 			}
 		}
 	}
-	return nil
+
+	req := B().Update(t.FormattedName(be)).Set(set)
+	if where != nil {
+		req = req.Where(where)
+	}
+	t.applySoftDelete(req, opt)
+	if err := t.applyTenant(ctx, req); err != nil {
+		return nil, err
+	}
+
+	if opt.LimitCount > 0 {
+		if opt.LimitStart > 0 {
+			req = req.Limit(opt.LimitStart, opt.LimitCount)
+		} else {
+			req = req.Limit(opt.LimitCount)
+		}
+	}
+	req = req.Apply(opt.Scopes...)
+
+	before, err := t.historyBefore(ctx, where, opt, opt.WithDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := req.ExecQuery(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, err.Error()+"\n"+debugStack(), "event", "psql:update_where:run_fail", "psql.table", t.table)
+		return nil, err
+	}
+	if err := t.historyAfter(ctx, "update", before); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
@@ -0,0 +1,96 @@
+package psql_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type partialOrder struct {
+	psql.Name `sql:"partial_orders"`
+	ID        uint64     `sql:",key=PRIMARY"`
+	Status    string     `sql:",type=VARCHAR,size=32"`
+	Note      string     `sql:",type=VARCHAR,size=128"`
+	Stock     int64      `sql:",type=BIGINT"`
+	UpdatedAt time.Time  `sql:",import=TS"`
+	DeletedAt *time.Time `sql:",import=TS"`
+}
+
+func TestUpdateFields(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	o := &partialOrder{ID: 5, Status: "shipped", Note: "ignored", UpdatedAt: at}
+	require.NoError(t, psql.UpdateFields(ctx, o, "Status", "UpdatedAt"))
+
+	q := db.Last()
+	assert.True(t, strings.HasPrefix(q.Query, `UPDATE "partial_orders" SET `))
+	assert.Contains(t, q.Query, `"Status" = ?`)
+	assert.Contains(t, q.Query, `"UpdatedAt" = ?`)
+	assert.NotContains(t, q.Query, `"Note"`)
+	assert.True(t, strings.HasSuffix(q.Query, `WHERE "ID" = ?`))
+	assert.Equal(t, at, o.UpdatedAt, "a listed UpdatedAt is written as given")
+	assert.Contains(t, q.Args, any(at.String()))
+}
+
+func TestUpdateFieldsByColumnAndUnknown(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	o := &partialOrder{ID: 5, Note: "hi"}
+	require.NoError(t, psql.UpdateFields(ctx, o, "Note"))
+	assert.Contains(t, db.Last().Query, `"UpdatedAt" = ?`)
+	assert.False(t, o.UpdatedAt.IsZero(), "UpdatedAt is refreshed when not listed")
+
+	err := psql.UpdateFields(ctx, o, "Nope")
+	assert.Error(t, err)
+}
+
+func TestUpdateFieldsVersion(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	doc := &versionedDoc{ID: 1, Title: "x", Version: 2}
+	require.NoError(t, psql.UpdateFields(ctx, doc, "Title"))
+	assert.True(t, strings.HasSuffix(db.Last().Query, `AND "Version" = ?`))
+	assert.Equal(t, int64(3), doc.Version)
+}
+
+func TestUpdateWhere(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	_, err := psql.UpdateWhere[partialOrder](ctx, map[string]any{"Status": "pending"},
+		map[string]any{"Stock": psql.Decr(1), "Note": "restocked"})
+	require.NoError(t, err)
+
+	q := db.Last()
+	assert.True(t, strings.HasPrefix(q.Query, `UPDATE "partial_orders" SET `))
+	assert.Contains(t, q.Query, `"Stock"="Stock"-`)
+	assert.Contains(t, q.Query, `"Note"=`)
+	assert.Contains(t, q.Query, `"UpdatedAt"=`)
+	assert.Contains(t, q.Query, `"DeletedAt" IS NULL`)
+}
+
+func TestUpdateWhereIncludeDeleted(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	_, err := psql.UpdateWhere[partialOrder](ctx, nil, map[string]any{"Note": "x"}, psql.IncludeDeleted())
+	require.NoError(t, err)
+	assert.NotContains(t, db.Last().Query, `"DeletedAt"`)
+
+	_, err = psql.UpdateWhere[partialOrder](ctx, nil, nil)
+	assert.Error(t, err)
+	_, err = psql.UpdateWhere[partialOrder](ctx, nil, map[string]any{"Bogus": 1})
+	assert.Error(t, err)
+}
+
+func TestUpdateWhereVersion(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	_, err := psql.UpdateWhere[versionedDoc](ctx, map[string]any{"ID": 1}, map[string]any{"Title": "y"})
+	require.NoError(t, err)
+	assert.Contains(t, db.Last().Query, `"Version"="Version"+`)
+}
@@ -0,0 +1,421 @@
+package psql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// UpsertOptions configures an [Upsert] call. Use [ConflictOn] and
+// [UpdateColumns] to build options; multiple options are merged.
+type UpsertOptions struct {
+	ConflictColumns []string // fields identifying a conflicting row (default: main key)
+	UpdateColumns   []string // fields overwritten on conflict (default: all but key and CreatedAt)
+}
+
+// ConflictOn returns an [UpsertOptions] setting the fields (Go field names or
+// column names) whose unique constraint triggers the update path. MySQL does
+// not support targeting a specific constraint: any unique key conflict triggers
+// the update there.
+func ConflictOn(fields ...string) *UpsertOptions {
+	return &UpsertOptions{ConflictColumns: fields}
+}
+
+// UpdateColumns returns an [UpsertOptions] setting the fields (Go field names
+// or column names) overwritten with the new values when a conflict occurs.
+func UpdateColumns(fields ...string) *UpsertOptions {
+	return &UpsertOptions{UpdateColumns: fields}
+}
+
+func resolveUpsertOpts(opts []*UpsertOptions) *UpsertOptions {
+	res := &UpsertOptions{}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if opt.ConflictColumns != nil {
+			res.ConflictColumns = opt.ConflictColumns
+		}
+		if opt.UpdateColumns != nil {
+			res.UpdateColumns = opt.UpdateColumns
+		}
+	}
+	return res
+}
+
+// Upsert inserts target, or updates the existing row if it conflicts on the
+// given columns. Unlike [Replace], the existing row is updated in place rather
+// than deleted and re-inserted, and only the selected columns are overwritten:
+//
+//	err := psql.Upsert(ctx, user, psql.ConflictOn("Email"), psql.UpdateColumns("Name", "UpdatedAt"))
+//
+// On PostgreSQL and SQLite this renders INSERT ... ON CONFLICT DO UPDATE, on
+// MySQL INSERT ... ON DUPLICATE KEY UPDATE. Other engines require a dialect
+// implementing [ConflictUpdateRenderer]. When the dialect supports RETURNING,
+// target is refreshed with the stored row. On MySQL, an integer main key left
+// at zero is filled from LastInsertId, including when an existing row was
+// updated.
+//
+// Fires [BeforeSaveHook] and [AfterSaveHook] if implemented. CreatedAt is set
+// if zero and never overwritten on update (on MySQL, it is reset to its
+// previous value when an existing row was updated), UpdatedAt is always
+// refreshed, and a version column is incremented when the existing row is
+// updated (a time version is set to the current time on both paths). The row
+// state of target is refreshed with the written columns.
+//
+// On tenant tables, unless the tenant field is one of the conflict columns,
+// a conflicting row of another tenant is left untouched and Upsert fails with
+// [ErrTenantMismatch]. This requires PostgreSQL or SQLite; on MySQL the
+// tenant field must be part of the conflict columns.
+func Upsert[T any](ctx context.Context, target *T, opts ...*UpsertOptions) error {
+	return Table[T]().Upsert(ctx, target, opts...)
+}
+
+func (t *TableMeta[T]) Upsert(ctx context.Context, target *T, opts ...*UpsertOptions) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	return t.runOp(ctx, &Operation{Type: OpUpsert, Objects: []any{target}}, func(ctx context.Context, op *Operation) error {
+		targets, err := opTargets[T](op)
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			if err := t.upsert(ctx, target, opts...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (t *TableMeta[T]) upsert(ctx context.Context, target *T, opts ...*UpsertOptions) error {
+	if t == nil {
+		return ErrNotReady
+	}
+	t.check(ctx)
+	if target == nil {
+		return errors.New("Upsert requires a non-nil target")
+	}
+	opt := resolveUpsertOpts(opts)
+
+	// resolve conflict columns
+	var conflict []string
+	if opt.ConflictColumns != nil {
+		for _, name := range opt.ConflictColumns {
+			f := findFieldByNameOrCol(t.fldcol, name)
+			if f == nil {
+				return fmt.Errorf("unknown field %q on table %s", name, t.table)
+			}
+			conflict = append(conflict, f.Column)
+		}
+	} else if t.mainKey != nil {
+		conflict = t.mainKey.Fields
+	}
+	if len(conflict) == 0 {
+		return errors.New("cannot use Upsert without a unique key or conflict columns")
+	}
+
+	// resolve update columns
+	var update []string
+	if opt.UpdateColumns != nil {
+		for _, name := range opt.UpdateColumns {
+			f := findFieldByNameOrCol(t.fldcol, name)
+			if f == nil {
+				return fmt.Errorf("unknown field %q on table %s", name, t.table)
+			}
+			if f == t.createdAt || f == t.version || f == t.tenant {
+				// the stored creation time is kept on conflict
+				continue
+			}
+			update = append(update, f.Column)
+		}
+	} else {
+		skip := make(map[string]bool)
+		for _, col := range conflict {
+			skip[col] = true
+		}
+		if t.mainKey != nil {
+			for _, col := range t.mainKey.Fields {
+				skip[col] = true
+			}
+		}
+		for _, f := range t.fields {
+			if skip[f.Column] || f == t.createdAt || f == t.version || f == t.tenant {
+				continue
+			}
+			update = append(update, f.Column)
+		}
+	}
+
+	be := GetBackend(ctx)
+	engine := be.Engine()
+
+	// Get the formatted table name (respects explicit names)
+	tableName := t.FormattedName(be)
+
+	ph := engine.Placeholders(len(t.fields), 1)
+	d := engine.dialect()
+	useReturning := false
+	if rr, ok := d.(ReturningRenderer); ok {
+		useReturning = rr.SupportsReturning()
+	}
+
+	// On MySQL, LAST_INSERT_ID(expr) makes the id of an updated row available
+	// through LastInsertId, allowing fill-back without RETURNING.
+	idField := t.lastInsertIdField()
+	useLastId := !useReturning && engine == EngineMySQL && idField != nil
+
+	// the conflicting row may belong to another tenant unless the tenant is
+	// part of the conflict columns
+	tenantGuard := t.tenant != nil && !slices.Contains(conflict, t.tenant.Column)
+
+	var req string
+	if ur, ok := d.(ConflictUpdateRenderer); ok {
+		if tenantGuard {
+			return fmt.Errorf("Upsert on tenant table %s requires the tenant in the conflict columns with engine %s", t.table, engine)
+		}
+		req = ur.UpsertSQL(tableName, t.fldStr, ph, conflict, update, t.upsertExtraSet(engine, tableName, useLastId))
+	} else {
+		req = "INSERT INTO " + QuoteName(tableName) + " (" + t.fldStr + ") VALUES (" + ph + ")"
+		set := t.upsertExtraSet(engine, tableName, useLastId)
+		switch engine {
+		case EnginePostgreSQL, EngineSQLite:
+			for _, col := range update {
+				set = append(set, QuoteName(col)+"=EXCLUDED."+QuoteName(col))
+			}
+			conflictCols := make([]string, len(conflict))
+			for i, c := range conflict {
+				conflictCols[i] = QuoteName(c)
+			}
+			req += " ON CONFLICT (" + strings.Join(conflictCols, ",") + ")"
+			if len(set) == 0 && tenantGuard {
+				// no-op update so that a row of another tenant is reported
+				set = append(set, conflictCols[0]+"=EXCLUDED."+conflictCols[0])
+			}
+			if len(set) == 0 {
+				req += " DO NOTHING"
+			} else {
+				req += " DO UPDATE SET " + strings.Join(set, ",")
+			}
+			if tenantGuard {
+				col := QuoteName(t.tenant.Column)
+				req += " WHERE " + QuoteName(tableName) + "." + col + "=EXCLUDED." + col
+			}
+		case EngineMySQL:
+			if tenantGuard {
+				// ON DUPLICATE KEY UPDATE cannot be made conditional
+				return fmt.Errorf("Upsert on tenant table %s requires the tenant in the conflict columns on MySQL", t.table)
+			}
+			for _, col := range update {
+				set = append(set, QuoteName(col)+"=VALUES("+QuoteName(col)+")")
+			}
+			if len(set) == 0 {
+				// no-op update so that conflicts are not reported as errors
+				set = append(set, QuoteName(conflict[0])+"="+QuoteName(conflict[0]))
+			}
+			req += " ON DUPLICATE KEY UPDATE " + strings.Join(set, ",")
+		default:
+			return fmt.Errorf("Upsert is not supported by engine %s", engine)
+		}
+	}
+
+	if useReturning {
+		req += " RETURNING " + t.fldStr
+	}
+
+	if h, ok := any(target).(BeforeSaveHook); ok {
+		if err := h.BeforeSave(ctx); err != nil {
+			return err
+		}
+	}
+
+	val := reflect.ValueOf(target).Elem()
+	var createdAt reflect.Value
+	if t.createdAt != nil {
+		// remember the value before touchCreate, see below
+		createdAt = reflect.New(val.Field(t.createdAt.Index).Type()).Elem()
+		createdAt.Set(val.Field(t.createdAt.Index))
+	}
+	t.touchCreate(be, val, true)
+	if t.version != nil && t.typ.Field(t.version.Index).Type == timeType {
+		// written as-is on both paths, see upsertExtraSet
+		f := val.Field(t.version.Index)
+		f.Set(t.nextVersion(be, f))
+	}
+
+	// the row that may be updated, for its old values
+	before, err := t.historyConflicts(ctx, val, [][]string{conflict})
+	if err != nil {
+		return err
+	}
+
+	params := make([]any, len(t.fields))
+	for n, f := range t.fields {
+		fval := val.Field(f.Index)
+		switch fval.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map:
+			if fval.IsNil() {
+				continue
+			}
+		}
+		params[n] = engine.export(fval.Interface(), f)
+	}
+
+	if useReturning {
+		rows, err := doQueryContext(ctx, req, params...)
+		if err != nil {
+			slog.ErrorContext(ctx, req+"\n"+err.Error()+"\n"+debugStack(), "event", "psql:upsert:run_fail", "psql.table", tableName)
+			return &Error{Query: req, Err: err}
+		}
+		// DO NOTHING produces no row on conflict
+		found := rows.Next()
+		if found {
+			// refreshes target and its row state with the stored row
+			if err := t.scanValueReturning(ctx, rows, target); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if !found && tenantGuard {
+			return t.upsertTenantError(conflict)
+		}
+	} else {
+		res, err := ExecContext(ctx, req, params...)
+		if err != nil {
+			slog.ErrorContext(ctx, req+"\n"+err.Error()+"\n"+debugStack(), "event", "psql:upsert:run_fail", "psql.table", tableName)
+			return &Error{Query: req, Err: err}
+		}
+		if tenantGuard {
+			if n, err := res.RowsAffected(); err == nil && n == 0 {
+				return t.upsertTenantError(conflict)
+			}
+		}
+		if useLastId {
+			if f := val.Field(idField.Index); f.IsZero() {
+				if id, err := res.LastInsertId(); err == nil && id > 0 {
+					setIntValue(f, id)
+				}
+			}
+		}
+		// MySQL reports 1 affected row for an insert, 2 (or 0 if nothing
+		// changed) for an update of the existing row
+		inserted := false
+		if engine == EngineMySQL {
+			if n, err := res.RowsAffected(); err == nil {
+				inserted = n == 1
+				if !inserted && createdAt.IsValid() {
+					// the stored row keeps its creation time, unknown here
+					val.Field(t.createdAt.Index).Set(createdAt)
+				}
+			}
+		}
+		t.upsertState(target, inserted, conflict, update)
+	}
+
+	if t.history {
+		var oldVals map[string]any
+		if len(before) > 0 {
+			oldVals = t.rowValues(reflect.ValueOf(before[0]).Elem())
+		}
+		if err := t.recordHistory(ctx, "upsert", val, oldVals, t.rowValues(val)); err != nil {
+			return err
+		}
+	}
+
+	if h, ok := any(target).(AfterSaveHook); ok {
+		if err := h.AfterSave(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upsertTenantError is returned when the row conflicting with an upsert
+// belongs to another tenant, and was left untouched.
+func (t *TableMeta[T]) upsertTenantError(conflict []string) error {
+	return fmt.Errorf("%w: %s row conflicting on %s belongs to another tenant", ErrTenantMismatch, t.table, strings.Join(conflict, ","))
+}
+
+// upsertState refreshes the row state of target after an upsert that did not
+// return the stored row: all columns are known to be stored if the row was
+// inserted, only the conflict and updated columns otherwise.
+func (t *TableMeta[T]) upsertState(target *T, inserted bool, conflict, update []string) {
+	if inserted {
+		t.ResetChanges(target)
+		return
+	}
+	st := t.rowstate(target)
+	val := reflect.ValueOf(target).Elem()
+	st.init = true
+	st.val = make(map[string]any, len(conflict)+len(update))
+	for _, cols := range [][]string{conflict, update} {
+		for _, col := range cols {
+			f := t.fldcol[col]
+			st.val[col] = stateValue(f, val.Field(f.Index).Interface())
+		}
+	}
+}
+
+// upsertExtraSet returns the SET expressions added to the update path of an
+// upsert besides the updated columns: version increment and LAST_INSERT_ID
+// capture on MySQL.
+func (t *TableMeta[T]) upsertExtraSet(engine Engine, tableName string, useLastId bool) []string {
+	var set []string
+	if t.version != nil {
+		col := QuoteName(t.version.Column)
+		if t.typ.Field(t.version.Index).Type == timeType {
+			switch engine {
+			case EnginePostgreSQL, EngineSQLite:
+				set = append(set, col+"=EXCLUDED."+col)
+			default:
+				set = append(set, col+"=VALUES("+col+")")
+			}
+		} else {
+			switch engine {
+			case EnginePostgreSQL, EngineSQLite:
+				set = append(set, col+"="+QuoteName(tableName)+"."+col+"+1")
+			default:
+				set = append(set, col+"="+col+"+1")
+			}
+		}
+	}
+	if useLastId {
+		col := QuoteName(t.lastInsertIdField().Column)
+		set = append(set, col+"=LAST_INSERT_ID("+col+")")
+	}
+	return set
+}
+
+// lastInsertIdField returns the main key field if it is made of a single
+// integer column, or nil.
+func (t *TableMeta[T]) lastInsertIdField() *StructField {
+	if t.mainKey == nil || len(t.mainKey.Fields) != 1 {
+		return nil
+	}
+	f := t.fldcol[t.mainKey.Fields[0]]
+	if f == nil {
+		return nil
+	}
+	switch t.typ.Field(f.Index).Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return f
+	}
+	return nil
+}
+
+// setIntValue assigns id to an integer field of any signedness.
+func setIntValue(f reflect.Value, id int64) {
+	switch f.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f.SetUint(uint64(id))
+	default:
+		f.SetInt(id)
+	}
+}
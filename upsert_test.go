@@ -0,0 +1,128 @@
+package psql_test
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type upsertUser struct {
+	psql.Name `sql:"upsert_users"`
+	ID        uint64    `sql:",key=PRIMARY"`
+	Email     string    `sql:",type=VARCHAR,size=128"`
+	Nick      string    `sql:",type=VARCHAR,size=128"`
+	CreatedAt time.Time `sql:",import=TS"`
+	UpdatedAt time.Time `sql:",import=TS"`
+}
+
+type fakeLastId int64
+
+func (r fakeLastId) LastInsertId() (int64, error) { return int64(r), nil }
+func (r fakeLastId) RowsAffected() (int64, error) { return 1, nil }
+
+func TestUpsertObjPostgreSQL(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	u := &upsertUser{ID: 1, Email: "a@example.com", Nick: "Alice"}
+	require.NoError(t, psql.Upsert(ctx, u, psql.ConflictOn("Email"), psql.UpdateColumns("Nick", "UpdatedAt")))
+
+	assert.Equal(t,
+		`INSERT INTO "upsert_users" ("ID","Email","Nick","CreatedAt","UpdatedAt") VALUES ($1,$2,$3,$4,$5) ON CONFLICT ("Email") DO UPDATE SET "Nick"=EXCLUDED."Nick","UpdatedAt"=EXCLUDED."UpdatedAt"`,
+		db.Last().Query)
+	assert.False(t, u.CreatedAt.IsZero())
+	assert.False(t, u.UpdatedAt.IsZero())
+}
+
+func TestUpsertDefaults(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	require.NoError(t, psql.Upsert(ctx, &upsertUser{ID: 1, Email: "a@example.com"}))
+	assert.Contains(t, db.Last().Query,
+		`ON CONFLICT ("ID") DO UPDATE SET "Email"=EXCLUDED."Email","Nick"=EXCLUDED."Nick","UpdatedAt"=EXCLUDED."UpdatedAt"`)
+}
+
+func TestUpsertMySQLLastInsertId(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineMySQL)
+	db.OnExec = func(q string, args []driver.Value) (driver.Result, error) {
+		return fakeLastId(42), nil
+	}
+
+	u := &upsertUser{Email: "a@example.com", Nick: "Alice"}
+	require.NoError(t, psql.Upsert(ctx, u, psql.ConflictOn("Email"), psql.UpdateColumns("Nick")))
+	assert.Equal(t,
+		`INSERT INTO "upsert_users" ("ID","Email","Nick","CreatedAt","UpdatedAt") VALUES (?,?,?,?,?) ON DUPLICATE KEY UPDATE "ID"=LAST_INSERT_ID("ID"),"Nick"=VALUES("Nick")`,
+		db.Last().Query)
+	assert.Equal(t, uint64(42), u.ID)
+}
+
+func TestUpsertVersion(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	require.NoError(t, psql.Upsert(ctx, &versionedDoc{ID: 1, Title: "x"}))
+	assert.Contains(t, db.Last().Query, `DO UPDATE SET "Version"="versioned_docs"."Version"+1,"Title"=EXCLUDED."Title"`)
+}
+
+func TestUpsertTimeVersion(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineMySQL)
+
+	doc := &stampedDoc{ID: 1, Title: "x"}
+	require.NoError(t, psql.Upsert(ctx, doc))
+	assert.Contains(t, db.Last().Query, `"Rev"=VALUES("Rev")`)
+	first := doc.Rev
+	assert.False(t, first.IsZero())
+
+	// a stale or reused object still moves the version forward
+	require.NoError(t, psql.Upsert(ctx, doc))
+	assert.True(t, doc.Rev.After(first), "version must grow")
+	assert.Contains(t, db.Last().Args, any(doc.Rev.String()))
+}
+
+func TestUpsertUnknownField(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.EnginePostgreSQL)
+
+	assert.Error(t, psql.Upsert(ctx, &upsertUser{}, psql.ConflictOn("Nope")))
+	assert.Error(t, psql.Upsert(ctx, &upsertUser{}, psql.UpdateColumns("Nope")))
+}
+
+type fakeAffected int64
+
+func (r fakeAffected) LastInsertId() (int64, error) { return 0, nil }
+func (r fakeAffected) RowsAffected() (int64, error) { return int64(r), nil }
+
+func TestUpsertMySQLConflict(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineMySQL)
+	db.OnExec = func(q string, args []driver.Value) (driver.Result, error) {
+		return fakeAffected(2), nil // existing row updated
+	}
+
+	u := &upsertUser{ID: 1, Email: "a@example.com", Nick: "Alice"}
+	require.NoError(t, psql.Upsert(ctx, u, psql.ConflictOn("Email"), psql.UpdateColumns("Nick", "CreatedAt")))
+	assert.Equal(t,
+		`INSERT INTO "upsert_users" ("ID","Email","Nick","CreatedAt","UpdatedAt") VALUES (?,?,?,?,?) ON DUPLICATE KEY UPDATE "ID"=LAST_INSERT_ID("ID"),"Nick"=VALUES("Nick")`,
+		db.Last().Query, "CreatedAt is never overwritten")
+	assert.True(t, u.CreatedAt.IsZero(), "stored creation time is not known")
+
+	changes := psql.Changes(u)
+	assert.NotContains(t, changes, "Nick")
+	assert.NotContains(t, changes, "Email")
+	assert.Contains(t, changes, "ID", "columns not written are unknown")
+
+	db.OnExec = func(q string, args []driver.Value) (driver.Result, error) {
+		return fakeAffected(1), nil // inserted
+	}
+	u = &upsertUser{ID: 2, Email: "b@example.com"}
+	require.NoError(t, psql.Upsert(ctx, u, psql.ConflictOn("Email")))
+	assert.False(t, u.CreatedAt.IsZero())
+	assert.False(t, psql.HasChanged(u))
+}
+
+func TestUpsertUnknownEngine(t *testing.T) {
+	_, ctx := fakedb.New(t, psql.Engine(103))
+
+	assert.Error(t, psql.Upsert(ctx, &upsertUser{ID: 1}))
+}
@@ -0,0 +1,46 @@
+package psql
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// isVersionType returns true if typ can be used as an optimistic locking
+// version column (any integer type, or time.Time).
+func isVersionType(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return typ == timeType
+}
+
+// nextVersion computes the value the version column will take after a
+// successful update: the current value plus one for integers, or the current
+// time (at the column's precision) for timestamps.
+func (t *TableMeta[T]) nextVersion(be *Backend, cur reflect.Value) reflect.Value {
+	next := reflect.New(cur.Type()).Elem()
+	switch cur.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		next.SetInt(cur.Int() + 1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		next.SetUint(cur.Uint() + 1)
+	default:
+		now := t.version.now(be)
+		if prev, ok := cur.Interface().(time.Time); ok && !now.After(prev) {
+			// make sure the version actually moves forward
+			now = prev.Add(t.version.precision(be))
+		}
+		next.Set(reflect.ValueOf(now))
+	}
+	return next
+}
+
+// staleError returns an error wrapping [ErrStaleObject] for this table.
+func (t *TableMeta[T]) staleError() error {
+	return fmt.Errorf("%w: %s was modified by another process", ErrStaleObject, t.table)
+}
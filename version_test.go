@@ -0,0 +1,102 @@
+package psql_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portablesql/psql"
+	"github.com/portablesql/psql/internal/fakedb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type versionedDoc struct {
+	psql.Name `sql:"versioned_docs"`
+	ID        uint64 `sql:",key=PRIMARY"`
+	Title     string `sql:",type=VARCHAR,size=128"`
+	Version   int64  `sql:",version"`
+}
+
+type stampedDoc struct {
+	psql.Name `sql:"stamped_docs"`
+	ID        uint64    `sql:",key=PRIMARY"`
+	Title     string    `sql:",type=VARCHAR,size=128"`
+	Rev       time.Time `sql:",version,import=TS"`
+}
+
+func TestVersionUpdateBumps(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	doc := &versionedDoc{ID: 1, Title: "hello", Version: 3}
+	require.NoError(t, psql.Update(ctx, doc))
+
+	q := db.Last()
+	assert.True(t, strings.HasPrefix(q.Query, `UPDATE "versioned_docs" SET `))
+	assert.True(t, strings.HasSuffix(q.Query, `WHERE "ID" = ? AND "Version" = ?`))
+	assert.Contains(t, q.Query, `"Version" = ?`)
+	assert.Contains(t, q.Args, int64(4))
+	assert.Equal(t, int64(3), q.Args[len(q.Args)-1])
+	assert.Equal(t, int64(4), doc.Version)
+}
+
+func TestVersionUpdateStale(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnExec = func(q string, args []driver.Value) (driver.Result, error) {
+		return driver.RowsAffected(0), nil
+	}
+
+	doc := &versionedDoc{ID: 1, Title: "hello", Version: 3}
+	err := psql.Update(ctx, doc)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, psql.ErrStaleObject))
+	assert.Equal(t, int64(3), doc.Version, "version must not change on failure")
+}
+
+func TestVersionUnchangedObjectSkipsUpdate(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+	db.OnQuery = func(q string, args []driver.Value) (*fakedb.Rows, error) {
+		return &fakedb.Rows{
+			Cols: []string{"ID", "Title", "Version"},
+			Data: [][]driver.Value{{"1", "hello", "7"}},
+		}, nil
+	}
+
+	doc, err := psql.Get[versionedDoc](ctx, map[string]any{"ID": 1})
+	require.NoError(t, err)
+	n := len(db.Queries())
+
+	require.NoError(t, psql.Update(ctx, doc))
+	assert.Len(t, db.Queries(), n, "no query expected for an unchanged object")
+
+	doc.Title = "changed"
+	require.NoError(t, psql.Update(ctx, doc))
+	q := db.Last()
+	assert.Contains(t, q.Query, `"Title" = ?`)
+	assert.Equal(t, int64(8), doc.Version)
+	assert.False(t, psql.HasChanged(doc))
+}
+
+func TestVersionTimestamp(t *testing.T) {
+	db, ctx := fakedb.New(t, psql.EngineSQLite)
+
+	prev := time.Now().UTC().Add(-time.Hour).Truncate(time.Microsecond)
+	doc := &stampedDoc{ID: 1, Title: "hello", Rev: prev}
+	require.NoError(t, psql.Update(ctx, doc))
+
+	q := db.Last()
+	assert.True(t, strings.HasSuffix(q.Query, `AND "Rev" = ?`))
+	assert.True(t, doc.Rev.After(prev))
+	assert.Equal(t, doc.Rev, doc.Rev.Truncate(time.Microsecond))
+}
+
+func TestVersionInvalidType(t *testing.T) {
+	type badVersion struct {
+		psql.Name `sql:"bad_version"`
+		ID        uint64 `sql:",key=PRIMARY"`
+		Version   string `sql:",version"`
+	}
+	assert.Panics(t, func() { psql.Table[badVersion]() })
+}